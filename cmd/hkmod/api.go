@@ -0,0 +1,328 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const (
+	apiName      = "Modding API"
+	assemblyName = "Assembly-CSharp.dll"
+	// This is the same suffix that Scarab uses, so that either tool can restore a backup
+	// made by the other.
+	vanillaBackupSuffix = ".v"
+	moddedBackupSuffix  = ".m"
+)
+
+func api(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: api install|status")
+	}
+	switch args[0] {
+	case "install":
+		return apiInstall()
+	case "status":
+		return apiStatus()
+	default:
+		return fmt.Errorf("unknown api subcommand: %q", args[0])
+	}
+}
+
+func apiInstall() error {
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	cachedir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	manifest, err := getAPILinks()
+	if err != nil {
+		return err
+	}
+	link, err := selectOSLink(&manifest.Links)
+	if err != nil {
+		return fmt.Errorf("cannot install %s: %w", apiName, err)
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	assembly := filepath.Join(installdir, assemblyName)
+	if db.API != nil && db.API.SHA256 == link.SHA256 {
+		if sha, err := sha256OfFile(assembly); err == nil && sha == db.API.ModdedSHA256 {
+			fmt.Printf("%s version %s is already installed\n", apiName, db.API.Version)
+			return nil
+		}
+	}
+
+	progress := newProgressView(os.Stdout)
+	file, err := getModFile(cachedir, apiName, link, progress)
+	progress.finish()
+	if err != nil {
+		return fmt.Errorf("cannot install %s: %w", apiName, err)
+	}
+	defer file.Close()
+	wrap := func(err error) error { return fmt.Errorf("install %s: %w", apiName, err) }
+	archive, err := zip.NewReader(file, file.Size)
+	if err != nil {
+		return wrap(err)
+	}
+	// Only the files that apilinks lists are installed; check that they are all there before
+	// touching any of them.
+	if len(manifest.Files) == 0 {
+		return wrap(fmt.Errorf("apilinks does not list any files to install"))
+	}
+	archiveFiles := make(map[string]*zip.File, len(archive.File))
+	for _, f := range archive.File {
+		if !f.FileInfo().IsDir() {
+			archiveFiles[path.Clean(f.Name)] = f
+		}
+	}
+	var moddedSHA string
+	for _, name := range manifest.Files {
+		f, ok := archiveFiles[path.Clean(filepath.ToSlash(name))]
+		if !ok {
+			return wrap(fmt.Errorf("archive does not contain %s", name))
+		}
+		if path.Base(f.Name) == assemblyName {
+			moddedSHA, err = sha256OfZipFile(f)
+			if err != nil {
+				return wrap(err)
+			}
+		}
+	}
+	if moddedSHA == "" {
+		return wrap(fmt.Errorf("apilinks does not list %s", assemblyName))
+	}
+	vanillaSHA, err := backupVanillaAssembly(installdir)
+	if err != nil {
+		return wrap(err)
+	}
+	for _, name := range manifest.Files {
+		f := archiveFiles[path.Clean(filepath.ToSlash(name))]
+		dest := filepath.Join(installdir, filepath.Join(string(filepath.Separator), filepath.FromSlash(f.Name)))
+		if err := writeZipFile(dest, f); err != nil {
+			return wrap(err)
+		}
+	}
+	db.API = &apiRecord{
+		Version:       manifest.Version,
+		URL:           link.URL,
+		SHA256:        link.SHA256,
+		InstalledAt:   time.Now().UTC(),
+		ModdedSHA256:  moddedSHA,
+		VanillaSHA256: vanillaSHA,
+	}
+	// Any modded assembly set aside by the vanilla command is now out of date.
+	if err := os.Remove(assembly + moddedBackupSuffix); err != nil && !os.IsNotExist(err) {
+		fmt.Println("warning:", err)
+	}
+	if err := db.save(modsdir); err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s version %s\n", apiName, manifest.Version)
+	if vanillaSHA == "" {
+		fmt.Println("warning: no backup of the vanilla", assemblyName, "exists")
+	}
+	return nil
+}
+
+// backupVanillaAssembly copies the game's Assembly-CSharp.dll to the backup location, unless
+// it is already modded. It returns the hash of the backup, or the empty string if there is none.
+func backupVanillaAssembly(installdir string) (string, error) {
+	assembly := filepath.Join(installdir, assemblyName)
+	backup := assembly + vanillaBackupSuffix
+	content, err := os.ReadFile(assembly)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if isModdedAssembly(content) {
+		content, err = os.ReadFile(backup)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if isModdedAssembly(content) {
+			return "", fmt.Errorf("%s is not vanilla", backup)
+		}
+	} else if err := os.WriteFile(backup, content, 0640); err != nil {
+		return "", err
+	}
+	sha := sha256.Sum256(content)
+	return hex.EncodeToString(sha[:]), nil
+}
+
+// isModdedAssembly reports whether the content of an Assembly-CSharp.dll file has the Modding API
+// built into it. The API's hooks class is a reliable marker, since its name is stored
+// verbatim in the assembly's metadata.
+func isModdedAssembly(content []byte) bool {
+	return bytes.Contains(content, []byte("ModHooks"))
+}
+
+func sha256OfZipFile(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	sha := sha256.New()
+	if _, err := io.Copy(sha, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sha.Sum(make([]byte, 0, sha256.Size))), nil
+}
+
+func apiStatus() error {
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	db, err := loadInstallDB(filepath.Join(installdir, "Mods"))
+	if err != nil {
+		return err
+	}
+	assembly := filepath.Join(installdir, assemblyName)
+	content, err := os.ReadFile(assembly)
+	if err != nil {
+		return err
+	}
+	state, err := currentGameState(installdir, db.API)
+	if err != nil {
+		return err
+	}
+	var status string
+	switch {
+	case db.API == nil && isModdedAssembly(content):
+		status = "installed (unknown version)"
+	case db.API == nil:
+		status = "not installed"
+	default:
+		status = "version " + db.API.Version
+		if manifest, err := getAPILinks(); err != nil {
+			fmt.Println("warning:", err)
+		} else if manifest.Version != db.API.Version {
+			status += " (latest: " + manifest.Version + ")"
+		}
+	}
+	fmt.Printf("%s: %s\n", apiName, status)
+	fmt.Println("Game state:", state)
+	// Whichever version of the assembly is not in use should be in its backup location.
+	backupName, backupSuffix := "Vanilla", vanillaBackupSuffix
+	if state == gameVanilla {
+		backupName, backupSuffix = "Modded", moddedBackupSuffix
+	}
+	backup := "missing"
+	if _, err := os.Stat(assembly + backupSuffix); err == nil {
+		backup = "present"
+	}
+	fmt.Printf("%s backup: %s\n", backupName, backup)
+	return nil
+}
+
+type gameState string
+
+const (
+	gameModded  gameState = "modded"
+	gameVanilla gameState = "vanilla"
+	gameUnknown gameState = "unknown"
+)
+
+// currentGameState determines whether the installed Assembly-CSharp.dll is the modded or
+// vanilla one recorded in rec, which may be nil.
+func currentGameState(installdir string, rec *apiRecord) (gameState, error) {
+	if rec == nil {
+		return gameUnknown, nil
+	}
+	sha, err := sha256OfFile(filepath.Join(installdir, assemblyName))
+	if err != nil {
+		return gameUnknown, err
+	}
+	switch sha {
+	case rec.ModdedSHA256:
+		return gameModded, nil
+	case rec.VanillaSHA256:
+		return gameVanilla, nil
+	default:
+		return gameUnknown, nil
+	}
+}
+
+func vanilla(args []string) error {
+	return switchGameState(gameVanilla)
+}
+
+func modded(args []string) error {
+	return switchGameState(gameModded)
+}
+
+// switchGameState swaps the modded and vanilla versions of Assembly-CSharp.dll so that the
+// target one is in place. Both files are checked against the hashes recorded when the API was
+// installed, so that we never overwrite a file we don't know about.
+func switchGameState(target gameState) error {
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	db, err := loadInstallDB(filepath.Join(installdir, "Mods"))
+	if err != nil {
+		return err
+	}
+	if db.API == nil {
+		return fmt.Errorf("%s was not installed by hkmod; run \"hkmod api install\" first", apiName)
+	}
+	if db.API.VanillaSHA256 == "" {
+		return fmt.Errorf("no backup of the vanilla %s exists", assemblyName)
+	}
+	state, err := currentGameState(installdir, db.API)
+	if err != nil {
+		return err
+	}
+	if state == target {
+		fmt.Println("The game is already", target)
+		return nil
+	}
+	if state == gameUnknown {
+		return fmt.Errorf("%s matches neither the modded nor the vanilla version; reinstall %s to fix this", assemblyName, apiName)
+	}
+
+	currentSuffix, targetSuffix, targetSHA := vanillaBackupSuffix, moddedBackupSuffix, db.API.ModdedSHA256
+	if target == gameVanilla {
+		currentSuffix, targetSuffix, targetSHA = moddedBackupSuffix, vanillaBackupSuffix, db.API.VanillaSHA256
+	}
+	assembly := filepath.Join(installdir, assemblyName)
+	sha, err := sha256OfFile(assembly + targetSuffix)
+	if err != nil {
+		return err
+	}
+	if sha != targetSHA {
+		return fmt.Errorf("%s does not match the %s version recorded at install time", assembly+targetSuffix, target)
+	}
+	if err := os.Rename(assembly, assembly+currentSuffix); err != nil {
+		return err
+	}
+	if err := os.Rename(assembly+targetSuffix, assembly); err != nil {
+		// Put back the original file, so that the game is left in a working state.
+		if rerr := os.Rename(assembly+currentSuffix, assembly); rerr != nil {
+			fmt.Println("warning:", rerr)
+		}
+		return err
+	}
+	fmt.Println("The game is now", target)
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+func autoremove(args []string) error {
+	flags := flag.NewFlagSet("autoremove", flag.ExitOnError)
+	var dryRun bool
+	flags.BoolVar(&dryRun, "n", false, "List the mods that would be removed, without removing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	enabled, err := installedMods(modsdir)
+	if err != nil {
+		return err
+	}
+	disabled, err := disabledMods(modsdir)
+	if err != nil {
+		return err
+	}
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	manifests, err := getModlinks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v; using only the dependencies recorded at install time\n", err)
+	}
+	orphans := findOrphanedDependencies(enabled, disabled, db, manifests)
+	if len(orphans) == 0 {
+		fmt.Println("No unneeded dependencies are installed.")
+		return nil
+	}
+	if dryRun {
+		for _, name := range orphans {
+			fmt.Println(name)
+		}
+		return nil
+	}
+	for _, name := range orphans {
+		if err := removePreviousVersion(name, installdir); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		delete(db.Mods, name)
+		fmt.Println("Yeeted", name)
+	}
+	return db.save(modsdir)
+}
+
+// findOrphanedDependencies returns, sorted by name, the enabled mods that were installed only as
+// dependencies and are no longer needed by any requested mod. Disabled mods still count as
+// needing their dependencies, so that they keep working when they are re-enabled.
+func findOrphanedDependencies(enabled, disabled []string, db *installDB, manifests []modlinks.Manifest) []string {
+	all := append(append([]string{}, enabled...), disabled...)
+	deps := installedDependencyGraph(all, db, manifests)
+	var roots []string
+	for _, name := range all {
+		if db.isRequested(name) {
+			roots = append(roots, name)
+		}
+	}
+	required := deps.requiredBy(roots)
+	var orphans []string
+	for _, name := range enabled {
+		if !required[name] {
+			orphans = append(orphans, name)
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mods are extracted into directories with these prefixes, inside the Mods directory, before being
+// moved into place; previous versions are kept in the same way until the installation is complete.
+const (
+	stagingPrefix = ".hkmod-staging-"
+	backupPrefix  = ".hkmod-backup-"
+)
+
+// An installBatch installs a set of mods such that, if any of them fails, all of them can be
+// rolled back to the versions that were previously installed.
+type installBatch struct {
+	modsdir string
+	swapped []swappedMod
+}
+
+type swappedMod struct {
+	name      string
+	hasBackup bool
+}
+
+func newInstallBatch(modsdir string) *installBatch {
+	recoverInterruptedBatch(modsdir)
+	return &installBatch{modsdir: modsdir}
+}
+
+// recoverInterruptedBatch cleans up after a batch that was interrupted before it could be
+// committed or rolled back, restoring any previous versions that were left without a
+// replacement.
+func recoverInterruptedBatch(modsdir string) {
+	entries, err := os.ReadDir(modsdir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		switch name := e.Name(); {
+		case strings.HasPrefix(name, stagingPrefix):
+			if err := os.RemoveAll(filepath.Join(modsdir, name)); err != nil {
+				fmt.Fprintln(os.Stderr, "warning:", err)
+			}
+		case strings.HasPrefix(name, backupPrefix):
+			backup := filepath.Join(modsdir, name)
+			dest := filepath.Join(modsdir, strings.TrimPrefix(name, backupPrefix))
+			if _, err := os.Stat(dest); os.IsNotExist(err) {
+				err = os.Rename(backup, dest)
+			} else {
+				err = os.RemoveAll(backup)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "warning:", err)
+			}
+		}
+	}
+}
+
+func isBatchDir(name string) bool {
+	return strings.HasPrefix(name, stagingPrefix) || strings.HasPrefix(name, backupPrefix)
+}
+
+// stage returns an empty directory into which the named mod can be extracted.
+func (b *installBatch) stage(name string) (string, error) {
+	// There's no way we can reasonably install a mod whose name contains a path separator.
+	// This also avoids any path traversal vulnerabilities from mod names.
+	if strings.ContainsRune(name, filepath.Separator) {
+		return "", fmt.Errorf("cannot install %s: contains path separator", name)
+	}
+	dir := filepath.Join(b.modsdir, stagingPrefix+name)
+	if err := os.RemoveAll(dir); err != nil {
+		return "", err
+	}
+	return dir, os.MkdirAll(dir, 0750)
+}
+
+// swap moves a mod extracted into its staging directory into place, setting aside the previously
+// installed version, if any.
+func (b *installBatch) swap(name, staging string) error {
+	wrap := func(err error) error { return fmt.Errorf("install %s: %w", name, err) }
+	dest := filepath.Join(b.modsdir, name)
+	backup := filepath.Join(b.modsdir, backupPrefix+name)
+	// Keep existing skins while reinstalling Custom Knight.
+	if name == customKnightName {
+		if err := copyMissingFiles(dest, staging); err != nil {
+			return wrap(err)
+		}
+	}
+	if err := os.RemoveAll(backup); err != nil {
+		return wrap(err)
+	}
+	hasBackup := true
+	if err := os.Rename(dest, backup); os.IsNotExist(err) {
+		hasBackup = false
+	} else if err != nil {
+		return wrap(err)
+	}
+	if err := os.Rename(staging, dest); err != nil {
+		if hasBackup {
+			if rerr := os.Rename(backup, dest); rerr != nil {
+				fmt.Fprintln(os.Stderr, "warning:", rerr)
+			}
+		}
+		return wrap(err)
+	}
+	b.swapped = append(b.swapped, swappedMod{name: name, hasBackup: hasBackup})
+	return nil
+}
+
+// replacedMods returns the set of mods in the batch that replaced a previously installed version.
+func (b *installBatch) replacedMods() map[string]bool {
+	replaced := map[string]bool{}
+	for _, m := range b.swapped {
+		if m.hasBackup {
+			replaced[m.name] = true
+		}
+	}
+	return replaced
+}
+
+// commit deletes the previous versions of all mods installed by the batch.
+func (b *installBatch) commit() {
+	for _, m := range b.swapped {
+		if m.hasBackup {
+			if err := os.RemoveAll(filepath.Join(b.modsdir, backupPrefix+m.name)); err != nil {
+				fmt.Fprintln(os.Stderr, "warning:", err)
+			}
+		}
+	}
+	b.swapped = nil
+}
+
+// rollback removes all mods installed by the batch, putting back their previous versions.
+func (b *installBatch) rollback() {
+	for i := len(b.swapped) - 1; i >= 0; i-- {
+		m := b.swapped[i]
+		dest := filepath.Join(b.modsdir, m.name)
+		if err := os.RemoveAll(dest); err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+			continue
+		}
+		if m.hasBackup {
+			if err := os.Rename(filepath.Join(b.modsdir, backupPrefix+m.name), dest); err != nil {
+				fmt.Fprintln(os.Stderr, "warning:", err)
+			}
+		}
+	}
+	b.swapped = nil
+}
+
+// copyMissingFiles copies every file in src that does not exist in dest, except for DLLs at the top
+// level, which belong to the old version of the mod.
+func copyMissingFiles(src, dest string) error {
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0750)
+		}
+		if filepath.Dir(rel) == "." && filepath.Ext(rel) == ".dll" {
+			return nil
+		}
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+		return copyFile(p, target)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func copyFile(src, dest string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
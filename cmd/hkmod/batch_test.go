@@ -0,0 +1,192 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testMods describes the contents of a Mods directory, mapping the name of each directory in it
+// to the files it contains, as for writeTestMod.
+type testMods map[string]map[string]string
+
+func writeTestMods(t *testing.T, modsdir string, mods testMods) {
+	t.Helper()
+	for name, files := range mods {
+		if err := os.MkdirAll(filepath.Join(modsdir, name), 0750); err != nil {
+			t.Fatal(err)
+		}
+		writeTestMod(t, filepath.Join(modsdir, name), files)
+	}
+}
+
+func readTestMods(t *testing.T, modsdir string) testMods {
+	t.Helper()
+	mods := testMods{}
+	err := filepath.WalkDir(modsdir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == modsdir {
+			return err
+		}
+		rel, err := filepath.Rel(modsdir, p)
+		if err != nil {
+			return err
+		}
+		mod, file, _ := strings.Cut(filepath.ToSlash(rel), "/")
+		if mods[mod] == nil {
+			mods[mod] = map[string]string{}
+		}
+		if d.IsDir() {
+			return nil
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		mods[mod][file] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mods
+}
+
+func TestInstallBatch(t *testing.T) {
+	type stagedFiles struct {
+		name  string
+		files map[string]string
+	}
+	cases := []struct {
+		desc     string
+		before   testMods
+		stage    []stagedFiles
+		rollback bool
+		want     testMods
+	}{
+		{
+			desc:   "commit",
+			before: testMods{"Benchwarp": {"Benchwarp.dll": "v1"}, "Other": {"Other.dll": "v1"}},
+			stage: []stagedFiles{
+				{"Benchwarp", map[string]string{"Benchwarp.dll": "v2"}},
+				{"ItemChanger", map[string]string{"ItemChanger.dll": "v1"}},
+			},
+			want: testMods{
+				"Benchwarp":   {"Benchwarp.dll": "v2"},
+				"ItemChanger": {"ItemChanger.dll": "v1"},
+				"Other":       {"Other.dll": "v1"},
+			},
+		},
+		{
+			desc:   "rollback",
+			before: testMods{"Benchwarp": {"Benchwarp.dll": "v1", "extra.txt": "old"}, "Other": {"Other.dll": "v1"}},
+			stage: []stagedFiles{
+				{"Benchwarp", map[string]string{"Benchwarp.dll": "v2"}},
+				{"ItemChanger", map[string]string{"ItemChanger.dll": "v1"}},
+			},
+			rollback: true,
+			want: testMods{
+				"Benchwarp": {"Benchwarp.dll": "v1", "extra.txt": "old"},
+				"Other":     {"Other.dll": "v1"},
+			},
+		},
+		{
+			desc: "Custom Knight skins are kept",
+			before: testMods{customKnightName: {
+				"CustomKnight.dll":         "v1",
+				"Skins/Default/Knight.png": "default v1",
+				"Skins/Mine/Knight.png":    "mine",
+			}},
+			stage: []stagedFiles{{customKnightName, map[string]string{
+				"CustomKnight.dll":         "v2",
+				"Skins/Default/Knight.png": "default v2",
+			}}},
+			want: testMods{customKnightName: {
+				"CustomKnight.dll":         "v2",
+				"Skins/Default/Knight.png": "default v2",
+				"Skins/Mine/Knight.png":    "mine",
+			}},
+		},
+		{
+			desc: "Custom Knight DLLs are not kept",
+			before: testMods{customKnightName: {
+				"CustomKnight.dll": "v1",
+				"Old.dll":          "v1",
+				"Skins/Plugin.dll": "skin",
+			}},
+			stage: []stagedFiles{{customKnightName, map[string]string{"CustomKnight.dll": "v2"}}},
+			want: testMods{customKnightName: {
+				"CustomKnight.dll": "v2",
+				"Skins/Plugin.dll": "skin",
+			}},
+		},
+		{
+			desc: "Custom Knight rollback",
+			before: testMods{customKnightName: {
+				"CustomKnight.dll":      "v1",
+				"Skins/Mine/Knight.png": "mine",
+			}},
+			stage:    []stagedFiles{{customKnightName, map[string]string{"CustomKnight.dll": "v2"}}},
+			rollback: true,
+			want: testMods{customKnightName: {
+				"CustomKnight.dll":      "v1",
+				"Skins/Mine/Knight.png": "mine",
+			}},
+		},
+	}
+	for _, c := range cases {
+		modsdir := t.TempDir()
+		writeTestMods(t, modsdir, c.before)
+		batch := newInstallBatch(modsdir)
+		for _, s := range c.stage {
+			stageTestMod(t, batch, s.name, s.files)
+		}
+		if c.rollback {
+			batch.rollback()
+		} else {
+			batch.commit()
+		}
+		if got := readTestMods(t, modsdir); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Mods = %v, want %v", c.desc, got, c.want)
+		}
+	}
+}
+
+func TestRecoverInterruptedBatch(t *testing.T) {
+	cases := []struct {
+		desc   string
+		before testMods
+		want   testMods
+	}{
+		{
+			desc:   "interrupted while staging",
+			before: testMods{"Benchwarp": {"Benchwarp.dll": "v1"}, stagingPrefix + "Benchwarp": {"Benchwarp.dll": "v2"}},
+			want:   testMods{"Benchwarp": {"Benchwarp.dll": "v1"}},
+		},
+		{
+			desc:   "interrupted between moving the old version out and the new one in",
+			before: testMods{backupPrefix + "Benchwarp": {"Benchwarp.dll": "v1"}, stagingPrefix + "Benchwarp": {"Benchwarp.dll": "v2"}},
+			want:   testMods{"Benchwarp": {"Benchwarp.dll": "v1"}},
+		},
+		{
+			desc:   "interrupted before committing",
+			before: testMods{backupPrefix + "Benchwarp": {"Benchwarp.dll": "v1"}, "Benchwarp": {"Benchwarp.dll": "v2"}},
+			want:   testMods{"Benchwarp": {"Benchwarp.dll": "v2"}},
+		},
+		{
+			desc:   "nothing to recover",
+			before: testMods{"Benchwarp": {"Benchwarp.dll": "v1"}},
+			want:   testMods{"Benchwarp": {"Benchwarp.dll": "v1"}},
+		},
+	}
+	for _, c := range cases {
+		modsdir := t.TempDir()
+		writeTestMods(t, modsdir, c.before)
+		newInstallBatch(modsdir)
+		if got := readTestMods(t, modsdir); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: Mods = %v, want %v", c.desc, got, c.want)
+		}
+	}
+}
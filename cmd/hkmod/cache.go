@@ -0,0 +1,364 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+func cache(args []string) error {
+	const usage = "usage: cache list|verify|prune|clear"
+	if len(args) < 1 {
+		return fmt.Errorf(usage)
+	}
+	cachedir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		return cacheList(cachedir)
+	case "verify":
+		return cacheVerify(cachedir)
+	case "prune":
+		return cachePrune(cachedir, args[1:])
+	case "clear":
+		if err := os.RemoveAll(cachedir); err != nil {
+			return err
+		}
+		fmt.Println("Cleared", cachedir)
+		return nil
+	default:
+		return fmt.Errorf("unknown cache subcommand: %q", args[0])
+	}
+}
+
+// cacheIndexName is the name of the file in the cache directory recording which URL each
+// cached file was downloaded from.
+const cacheIndexName = "urls.json"
+
+var cacheIndexMutex sync.Mutex
+
+// cacheEntryName returns the name under which the file with the given hash, downloaded from url, is
+// cached.
+func cacheEntryName(sha, url string) string {
+	return strings.ToLower(sha) + path.Ext(url)
+}
+
+var cacheEntryPattern = regexp.MustCompile(`^([0-9a-f]{64})(\.|$)`)
+
+// lookupCachedURL returns the name of the cache entry downloaded from url, or the empty string if
+// there is none.
+func lookupCachedURL(cachedir, url string) string {
+	cacheIndexMutex.Lock()
+	defer cacheIndexMutex.Unlock()
+	return readCacheIndex(cachedir)[url]
+}
+
+// recordCachedURL records that a cache entry was downloaded from url. Failing to do so
+// only means that installfile will not be able to reuse it offline, so errors are merely reported.
+func recordCachedURL(cachedir, url, entry string) {
+	cacheIndexMutex.Lock()
+	defer cacheIndexMutex.Unlock()
+	index := readCacheIndex(cachedir)
+	index[url] = entry
+	content, err := json.MarshalIndent(index, "", "\t")
+	if err == nil {
+		err = writeFileAtomic(filepath.Join(cachedir, cacheIndexName), content)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: update cache index:", err)
+	}
+}
+
+func readCacheIndex(cachedir string) map[string]string {
+	index := map[string]string{}
+	if content, err := os.ReadFile(filepath.Join(cachedir, cacheIndexName)); err == nil {
+		if err := json.Unmarshal(content, &index); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: read cache index:", err)
+		}
+	}
+	return index
+}
+
+type cacheEntry struct {
+	path    string
+	size    dataSize
+	modTime time.Time
+	// sha is the hash of the file according to its name. It is empty for partial downloads,
+	// and for files cached by older versions of hkmod, which were named after the mod.
+	sha string
+}
+
+func (e *cacheEntry) name() string { return filepath.Base(e.path) }
+
+func isPartialDownload(path string) bool { return strings.HasSuffix(path, ".part") }
+
+// listCache returns all files in the cache, from least to most recently used.
+func listCache(cachedir string) ([]cacheEntry, error) {
+	dirEntries, err := os.ReadDir(cachedir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list cache: %w", err)
+	}
+	entries := make([]cacheEntry, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		if !de.Type().IsRegular() || de.Name() == cacheIndexName {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			return nil, fmt.Errorf("list cache: %w", err)
+		}
+		e := cacheEntry{
+			path:    filepath.Join(cachedir, de.Name()),
+			size:    dataSize(info.Size()),
+			modTime: info.ModTime(),
+		}
+		if m := cacheEntryPattern.FindStringSubmatch(de.Name()); m != nil && !isPartialDownload(de.Name()) {
+			e.sha = m[1]
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	return entries, nil
+}
+
+// A cacheCatalog identifies which modlinks entries cached files correspond to.
+type cacheCatalog struct {
+	bySHA map[string]string
+}
+
+// loadCacheCatalog indexes all files listed on modlinks, including the Modding API, by hash.
+func loadCacheCatalog() (*cacheCatalog, error) {
+	manifests, err := getModlinks()
+	if err != nil {
+		return nil, err
+	}
+	cat := &cacheCatalog{bySHA: map[string]string{}}
+	add := func(link modlinks.Link, desc string) {
+		if link.SHA256 != "" {
+			cat.bySHA[strings.ToLower(link.SHA256)] = desc
+		}
+	}
+	for _, m := range manifests {
+		desc := m.Name + " " + m.Version
+		add(m.Link, desc)
+		if ol := m.OSLinks; ol != nil {
+			add(ol.Windows, desc)
+			add(ol.Mac, desc)
+			add(ol.Linux, desc)
+		}
+	}
+	if api, err := getAPILinks(); err == nil {
+		desc := apiName + " " + api.Version
+		add(api.Links.Windows, desc)
+		add(api.Links.Mac, desc)
+		add(api.Links.Linux, desc)
+	}
+	return cat, nil
+}
+
+// identify returns a description of the modlinks entry matching a cache entry, or the empty
+// string if there is none.
+func (cat *cacheCatalog) identify(e *cacheEntry) string {
+	if e.sha == "" {
+		return ""
+	}
+	return cat.bySHA[e.sha]
+}
+
+func cacheList(cachedir string) error {
+	entries, err := listCache(cachedir)
+	if err != nil {
+		return err
+	}
+	cat, err := loadCacheCatalog()
+	if err != nil {
+		fmt.Println("warning:", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "File\tSize\tLast used\tModlinks entry")
+	var total dataSize
+	for i := range entries {
+		e := &entries[i]
+		total += e.size
+		desc := "unknown"
+		switch {
+		case isPartialDownload(e.path):
+			desc = "partial download"
+		case cat != nil:
+			if d := cat.identify(e); d != "" {
+				desc = d
+			} else {
+				desc = "none"
+			}
+		}
+		name := e.name()
+		if e.sha != "" {
+			// The full hash takes up too much space; this is enough to tell entries apart.
+			name = e.sha[:12] + "…" + strings.TrimPrefix(name, e.sha)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, e.size, e.modTime.Format("2006-01-02"), desc)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d files, %s total\n", len(entries), total)
+	return nil
+}
+
+func cacheVerify(cachedir string) error {
+	entries, err := listCache(cachedir)
+	if err != nil {
+		return err
+	}
+	cat, err := loadCacheCatalog()
+	if err != nil {
+		return err
+	}
+	stale, corrupt := 0, 0
+	for i := range entries {
+		e := &entries[i]
+		if isPartialDownload(e.path) {
+			continue
+		}
+		if e.sha != "" {
+			sha, err := sha256OfFile(e.path)
+			if err != nil {
+				return err
+			}
+			if sha != e.sha {
+				fmt.Printf("%s: corrupt (hash is %s)\n", e.name(), sha)
+				corrupt++
+				continue
+			}
+		}
+		if desc := cat.identify(e); desc != "" {
+			fmt.Printf("%s: ok (%s)\n", e.name(), desc)
+		} else {
+			fmt.Printf("%s: matches no current modlinks entry\n", e.name())
+			stale++
+		}
+	}
+	if stale > 0 {
+		fmt.Printf("%d stale files; run \"hkmod cache prune -stale\" to remove them\n", stale)
+	}
+	if corrupt > 0 {
+		return fmt.Errorf("%d corrupt files in cache", corrupt)
+	}
+	return nil
+}
+
+func cachePrune(cachedir string, args []string) error {
+	flags := flag.NewFlagSet("cache prune", flag.ExitOnError)
+	var maxAge time.Duration
+	var maxSizeText string
+	var stale bool
+	flags.DurationVar(&maxAge, "older-than", 0, "Remove files not used in the last `duration`")
+	flags.StringVar(&maxSizeText, "max-size", "", "Remove the least recently used files until the cache is no bigger than `size` (e.g. 500MB)")
+	flags.BoolVar(&stale, "stale", false, "Remove files that match no current modlinks entry")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if maxAge == 0 && maxSizeText == "" && !stale {
+		return fmt.Errorf("usage: cache prune [-older-than duration] [-max-size size] [-stale]")
+	}
+	maxSize := dataSize(-1)
+	if maxSizeText != "" {
+		var err error
+		maxSize, err = parseDataSize(maxSizeText)
+		if err != nil {
+			return err
+		}
+	}
+	entries, err := listCache(cachedir)
+	if err != nil {
+		return err
+	}
+	var cat *cacheCatalog
+	if stale {
+		cat, err = loadCacheCatalog()
+		if err != nil {
+			return err
+		}
+	}
+
+	var freed, total dataSize
+	removed := 0
+	remove := func(e *cacheEntry) error {
+		if err := os.Remove(e.path); err != nil {
+			return err
+		}
+		removed++
+		freed += e.size
+		return nil
+	}
+	now := time.Now()
+	var kept []*cacheEntry
+	for i := range entries {
+		e := &entries[i]
+		prune := maxAge != 0 && now.Sub(e.modTime) > maxAge
+		if !prune && stale && !isPartialDownload(e.path) {
+			prune = cat.identify(e) == ""
+		}
+		if prune {
+			if err := remove(e); err != nil {
+				return err
+			}
+			continue
+		}
+		kept = append(kept, e)
+		total += e.size
+	}
+	// The entries are sorted from least to most recently used, so this removes the least
+	// recently used ones first.
+	for _, e := range kept {
+		if maxSize < 0 || total <= maxSize {
+			break
+		}
+		if err := remove(e); err != nil {
+			return err
+		}
+		total -= e.size
+	}
+	fmt.Printf("Removed %d files, freeing %s\n", removed, freed)
+	return nil
+}
+
+// parseDataSize parses a size in bytes, optionally followed by one of the units used by
+// dataSize.String.
+func parseDataSize(s string) (dataSize, error) {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{{"GB", 1e9}, {"MB", 1e6}, {"kB", 1e3}, {"KB", 1e3}, {"B", 1}}
+	text := strings.TrimSpace(s)
+	scale := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(text, u.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, u.suffix))
+			scale = u.scale
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return dataSize(n * scale), nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+func check(args []string) error {
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	installed, err := installedMods(modsdir)
+	if err != nil {
+		return err
+	}
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	manifests, err := getModlinks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v; using only the dependencies recorded at install time\n", err)
+	}
+	versions := installedVersions(installed, db)
+	problems := findDependencyProblems(versions, installedDependencies(installed, db, manifests))
+	if len(problems) == 0 {
+		fmt.Println("All dependencies are satisfied.")
+		return nil
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) == 1 {
+		return fmt.Errorf("1 dependency problem found")
+	}
+	return fmt.Errorf("%d dependency problems found", len(problems))
+}
+
+// installedVersions maps each installed mod to its version, which is empty if hkmod has no record
+// of it.
+func installedVersions(installed []string, db *installDB) map[string]string {
+	versions := make(map[string]string, len(installed))
+	for _, name := range installed {
+		versions[name] = ""
+		if rec := db.lookup(name); rec != nil {
+			versions[name] = rec.Version
+		}
+	}
+	return versions
+}
+
+// A dependencyProblem is a dependency of an installed mod that is missing, or whose installed
+// version does not satisfy the mod's constraint.
+type dependencyProblem struct {
+	mod    string
+	dep    modlinks.Dependency
+	reason string
+}
+
+func (p dependencyProblem) String() string {
+	return fmt.Sprintf("%s requires %s, but %s", p.mod, p.dep, p.reason)
+}
+
+// findDependencyProblems checks that the dependencies of every mod in versions, which maps each
+// installed mod to its version, are installed at suitable versions.
+func findDependencyProblems(versions map[string]string, deps map[string][]modlinks.Dependency) []dependencyProblem {
+	mods := make([]string, 0, len(versions))
+	for name := range versions {
+		mods = append(mods, name)
+	}
+	sort.Strings(mods)
+	var problems []dependencyProblem
+	for _, mod := range mods {
+		for _, d := range deps[mod] {
+			version, ok := versions[d.Name]
+			var reason string
+			switch {
+			case !ok:
+				reason = "it is not installed"
+			case d.Version == "":
+				continue
+			case version == "":
+				reason = "its installed version is unknown"
+			default:
+				satisfied, err := d.SatisfiedBy(version)
+				if err != nil {
+					reason = fmt.Sprintf("this cannot be checked: %v", err)
+				} else if satisfied {
+					continue
+				} else {
+					reason = "version " + version + " is installed"
+				}
+			}
+			problems = append(problems, dependencyProblem{mod: mod, dep: d, reason: reason})
+		}
+	}
+	return problems
+}
+
+// warnDependencyProblems reports to w any dependency problems involving the given mods that would
+// remain once they are installed.
+func warnDependencyProblems(w io.Writer, modsdir string, mods []modlinks.Manifest, db *installDB) {
+	installed, err := installedMods(modsdir)
+	if err != nil {
+		fmt.Fprintln(w, "warning:", err)
+		return
+	}
+	versions := installedVersions(installed, db)
+	deps := installedDependencies(installed, db, nil)
+	changing := make(map[string]bool, len(mods))
+	for _, m := range mods {
+		versions[m.Name] = m.Version
+		deps[m.Name] = m.Dependencies
+		changing[m.Name] = true
+	}
+	for _, p := range findDependencyProblems(versions, deps) {
+		if changing[p.mod] || changing[p.dep.Name] {
+			fmt.Fprintln(w, "warning:", p)
+		}
+	}
+}
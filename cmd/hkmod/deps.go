@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+// A dependencyGraph maps each installed mod to the names of the mods it depends on.
+type dependencyGraph map[string][]string
+
+// installedDependencyGraph builds the dependency graph of the installed mods, as described by
+// installedDependencies.
+func installedDependencyGraph(installed []string, db *installDB, manifests []modlinks.Manifest) dependencyGraph {
+	g := make(dependencyGraph, len(installed))
+	for name, deps := range installedDependencies(installed, db, manifests) {
+		g[name] = modlinks.DependencyNames(deps)
+	}
+	return g
+}
+
+// installedDependencies returns the dependencies of each installed mod. The dependencies recorded
+// when each mod was installed are used when available, since they describe the version that is
+// actually installed; otherwise they are taken from modlinks.
+func installedDependencies(installed []string, db *installDB, manifests []modlinks.Manifest) map[string][]modlinks.Dependency {
+	manifestsByName := make(map[string]*modlinks.Manifest, len(manifests))
+	for i := range manifests {
+		manifestsByName[manifests[i].Name] = &manifests[i]
+	}
+	deps := make(map[string][]modlinks.Dependency, len(installed))
+	for _, name := range installed {
+		if rec := db.lookup(name); rec != nil && rec.Dependencies != nil {
+			deps[name] = rec.Dependencies
+		} else if m, ok := manifestsByName[name]; ok {
+			deps[name] = m.Dependencies
+		} else {
+			deps[name] = nil
+		}
+	}
+	return deps
+}
+
+// dependents returns, sorted by name, the mods that depend on any of targets, either directly or
+// through other mods. The targets themselves are not included.
+func (g dependencyGraph) dependents(targets map[string]bool) []string {
+	reached := make(map[string]bool, len(targets))
+	for name := range targets {
+		reached[name] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for name, deps := range g {
+			if reached[name] {
+				continue
+			}
+			for _, dep := range deps {
+				if reached[dep] {
+					reached[name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	var result []string
+	for name := range reached {
+		if !targets[name] {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// requiredBy returns the set of mods that roots depend on, directly or through other mods,
+// including roots themselves.
+func (g dependencyGraph) requiredBy(roots []string) map[string]bool {
+	required := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if required[name] {
+			return
+		}
+		required[name] = true
+		for _, dep := range g[name] {
+			visit(dep)
+		}
+	}
+	for _, name := range roots {
+		visit(name)
+	}
+	return required
+}
+
+// loadInstalledGraph returns the dependency graph of all installed mods, enabled or disabled,
+// along with the install database.
+func loadInstalledGraph() (dependencyGraph, *installDB, error) {
+	installdir, err := installDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	enabled, err := installedMods(modsdir)
+	if err != nil {
+		return nil, nil, err
+	}
+	disabled, err := disabledMods(modsdir)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifests, err := getModlinks()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v; using only the dependencies recorded at install time\n", err)
+	}
+	return installedDependencyGraph(append(enabled, disabled...), db, manifests), db, nil
+}
+
+// isRequested reports whether the named mod was installed on request, as opposed to only as a
+// dependency of other mods.
+func (db *installDB) isRequested(name string) bool {
+	rec := db.lookup(name)
+	return rec == nil || !rec.AsDependency
+}
+
+func deps(args []string) error {
+	flags := flag.NewFlagSet("deps", flag.ExitOnError)
+	var reverse, dot bool
+	flags.BoolVar(&reverse, "reverse", false, "Show the installed mods that depend on the named mod, instead of its dependencies")
+	flags.BoolVar(&dot, "dot", false, "Print the graph of the named mods and their dependencies, or of all installed mods, in Graphviz DOT format")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if dot {
+		return depsDot(args)
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: deps [-reverse] mod, or deps -dot [modnames ...]")
+	}
+	if reverse {
+		g, _, err := loadInstalledGraph()
+		if err != nil {
+			return err
+		}
+		name, err := resolveModName(g.names(), args[0])
+		if err != nil {
+			return err
+		}
+		g.reverse().printTree(os.Stdout, name)
+		return nil
+	}
+	manifests, err := getModlinks()
+	if err != nil {
+		return err
+	}
+	name, err := resolveMod(manifests, args[0])
+	if err != nil {
+		return err
+	}
+	closure, err := modlinks.TransitiveClosure(manifests, []string{name})
+	if err != nil {
+		fmt.Println("warning:", err)
+	}
+	manifestGraph(closure).printTree(os.Stdout, name)
+	return nil
+}
+
+// depsDot prints the dependency graph of the named mods from modlinks or, if there are none, that
+// of the installed mods. Mods that were installed only as dependencies are drawn dashed.
+func depsDot(args []string) error {
+	if len(args) == 0 {
+		g, db, err := loadInstalledGraph()
+		if err != nil {
+			return err
+		}
+		return g.writeDot(os.Stdout, func(name string) bool { return !db.isRequested(name) })
+	}
+	manifests, err := getModlinks()
+	if err != nil {
+		return err
+	}
+	requested := make(map[string]bool, len(args))
+	for _, arg := range args {
+		name, err := resolveMod(manifests, arg)
+		if err != nil {
+			return err
+		}
+		requested[name] = true
+	}
+	closure, err := modlinks.TransitiveClosure(manifests, sortedKeys(requested))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
+	return manifestGraph(closure).writeDot(os.Stdout, func(name string) bool { return !requested[name] })
+}
+
+func why(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: why mod")
+	}
+	g, db, err := loadInstalledGraph()
+	if err != nil {
+		return err
+	}
+	target, err := resolveModName(g.names(), args[0])
+	if err != nil {
+		return err
+	}
+	if db.isRequested(target) {
+		fmt.Println(target, "was installed on request")
+	}
+	var paths [][]string
+	for _, root := range g.names() {
+		if root == target || !db.isRequested(root) {
+			continue
+		}
+		if p := g.shortestPath(root, target); p != nil {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		if !db.isRequested(target) {
+			fmt.Println(target, "is not needed by any requested mod; \"hkmod autoremove\" will remove it")
+		}
+		return nil
+	}
+	fmt.Println(target, "is needed by:")
+	for _, p := range paths {
+		fmt.Println("\t" + strings.Join(p, " -> "))
+	}
+	return nil
+}
+
+func manifestGraph(manifests []modlinks.Manifest) dependencyGraph {
+	g := make(dependencyGraph, len(manifests))
+	for _, m := range manifests {
+		g[m.Name] = modlinks.DependencyNames(m.Dependencies)
+	}
+	return g
+}
+
+// names returns the names of all mods in g, sorted.
+func (g dependencyGraph) names() []string {
+	names := make([]string, 0, len(g))
+	for name := range g {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reverse returns the graph of which mods depend on each mod in g.
+func (g dependencyGraph) reverse() dependencyGraph {
+	r := make(dependencyGraph, len(g))
+	for _, name := range g.names() {
+		if _, ok := r[name]; !ok {
+			r[name] = nil
+		}
+		for _, dep := range g[name] {
+			r[dep] = append(r[dep], name)
+		}
+	}
+	return r
+}
+
+// printTree prints the mods that root depends on, and theirs in turn, as an indented tree. Mods
+// whose dependencies were already shown are not expanded again.
+func (g dependencyGraph) printTree(w io.Writer, root string) {
+	expanded := map[string]bool{}
+	var visit func(name string, depth int, path map[string]bool)
+	visit = func(name string, depth int, path map[string]bool) {
+		indent := strings.Repeat("    ", depth)
+		deps, ok := g[name]
+		switch {
+		case !ok:
+			fmt.Fprintf(w, "%s%s (missing)\n", indent, name)
+			return
+		case path[name]:
+			fmt.Fprintf(w, "%s%s (cycle)\n", indent, name)
+			return
+		case expanded[name] && len(deps) > 0:
+			fmt.Fprintf(w, "%s%s (see above)\n", indent, name)
+			return
+		}
+		fmt.Fprintf(w, "%s%s\n", indent, name)
+		expanded[name] = true
+		path[name] = true
+		sorted := append([]string{}, deps...)
+		sort.Strings(sorted)
+		for _, dep := range sorted {
+			visit(dep, depth+1, path)
+		}
+		delete(path, name)
+	}
+	visit(root, 0, map[string]bool{})
+}
+
+// shortestPath returns the shortest chain of dependencies leading from one mod to another, or nil
+// if there is none.
+func (g dependencyGraph) shortestPath(from, to string) []string {
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if name == to {
+			var path []string
+			for n := to; n != ""; n = prev[n] {
+				path = append([]string{n}, path...)
+			}
+			return path
+		}
+		sorted := append([]string{}, g[name]...)
+		sort.Strings(sorted)
+		for _, dep := range sorted {
+			if _, seen := prev[dep]; !seen {
+				prev[dep] = name
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// writeDot writes g in Graphviz DOT format. Mods for which dashed returns true are drawn with a
+// dashed outline.
+func (g dependencyGraph) writeDot(w io.Writer, dashed func(name string) bool) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph mods {")
+	for _, name := range g.names() {
+		if dashed(name) {
+			fmt.Fprintf(bw, "\t%s [style=dashed];\n", strconv.Quote(name))
+		} else {
+			fmt.Fprintf(bw, "\t%s;\n", strconv.Quote(name))
+		}
+	}
+	for _, name := range g.names() {
+		sorted := append([]string{}, g[name]...)
+		sort.Strings(sorted)
+		for _, dep := range sorted {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", strconv.Quote(name), strconv.Quote(dep))
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// disabledDirName is the directory, inside the Mods directory, where disabled mods are kept.
+// The Modding API does not load anything from it, and other installers use the same convention.
+const disabledDirName = "Disabled"
+
+func disable(args []string) error {
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	mods, err := installedMods(modsdir)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		mod, err := resolveModName(mods, arg)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if err := disableMod(modsdir, mod); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println("Disabled", mod)
+	}
+	return nil
+}
+
+func enable(args []string) error {
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	mods, err := disabledMods(modsdir)
+	if err != nil {
+		return err
+	}
+	for _, arg := range args {
+		mod, err := resolveModName(mods, arg)
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if err := enableMod(modsdir, mod); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println("Enabled", mod)
+	}
+	return nil
+}
+
+func disableMod(modsdir, name string) error {
+	disabledDir := filepath.Join(modsdir, disabledDirName)
+	if err := os.MkdirAll(disabledDir, 0750); err != nil {
+		return fmt.Errorf("disable %s: %w", name, err)
+	}
+	return moveModDir(filepath.Join(modsdir, name), filepath.Join(disabledDir, name))
+}
+
+func enableMod(modsdir, name string) error {
+	return moveModDir(filepath.Join(modsdir, disabledDirName, name), filepath.Join(modsdir, name))
+}
+
+// moveModDir moves a mod directory, refusing to overwrite anything already at the destination.
+func moveModDir(src, dest string) error {
+	if _, err := os.Stat(dest); err == nil {
+		return fmt.Errorf("move %s: %s already exists", src, dest)
+	}
+	if err := os.Rename(src, dest); err != nil {
+		return fmt.Errorf("move %s: %w", src, err)
+	}
+	return nil
+}
+
+// removeDisabledMod deletes the disabled copy of the named mod.
+func removeDisabledMod(name, installdir string) error {
+	if err := os.RemoveAll(filepath.Join(installdir, "Mods", disabledDirName, name)); err != nil {
+		return fmt.Errorf("yeet disabled %s: %w", name, err)
+	}
+	return nil
+}
+
+func disabledMods(modsdir string) ([]string, error) {
+	mods, err := installedMods(filepath.Join(modsdir, disabledDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return mods, err
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+// historyFileName is the name of the file, in the config directory, that records every version
+// of every mod that hkmod has seen on modlinks, so that old versions can be installed after they
+// are replaced. Unlike the cache, it can't be rebuilt once lost, so it isn't kept there.
+const historyFileName = "history.json"
+
+type historicalVersion struct {
+	Version      string                `json:"version"`
+	URL          string                `json:"url"`
+	SHA256       string                `json:"sha256"`
+	Dependencies []modlinks.Dependency `json:"dependencies,omitempty"`
+	FirstSeen    time.Time             `json:"firstSeen"`
+}
+
+// A modHistory lists the known versions of each mod, from oldest to newest.
+type modHistory map[string][]historicalVersion
+
+func historyPath() (string, error) {
+	configdir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configdir, historyFileName), nil
+}
+
+func loadHistory() (modHistory, error) {
+	h := modHistory{}
+	file, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(file)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("read modlinks history: %w", err)
+	default:
+		if err := json.Unmarshal(content, &h); err != nil {
+			return nil, fmt.Errorf("read modlinks history: %w", err)
+		}
+	}
+	return h, nil
+}
+
+func (h modHistory) save() error {
+	wrap := func(err error) error { return fmt.Errorf("write modlinks history: %w", err) }
+	file, err := historyPath()
+	if err != nil {
+		return wrap(err)
+	}
+	content, err := json.MarshalIndent(h, "", "\t")
+	if err != nil {
+		return wrap(err)
+	}
+	if err := writeFileAtomic(file, content); err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// recordHistory adds the versions of mods listed in manifests to the history. Failing to do so
+// only means that those versions can't be installed by number later, so errors are merely
+// reported.
+func recordHistory(manifests []modlinks.Manifest) {
+	h, err := loadHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+		return
+	}
+	changed := false
+	now := time.Now().UTC()
+	for i := range manifests {
+		m := &manifests[i]
+		link, err := selectLink(m)
+		if err != nil {
+			continue
+		}
+		if h.lookup(m.Name, link.SHA256) == nil {
+			h[m.Name] = append(h[m.Name], historicalVersion{
+				Version:      m.Version,
+				URL:          link.URL,
+				SHA256:       link.SHA256,
+				Dependencies: m.Dependencies,
+				FirstSeen:    now,
+			})
+			changed = true
+		}
+	}
+	if changed {
+		if err := h.save(); err != nil {
+			fmt.Fprintln(os.Stderr, "warning:", err)
+		}
+	}
+}
+
+// lookup returns the recorded version of the named mod with the given hash, or nil if there is
+// none.
+func (h modHistory) lookup(name, sha string) *historicalVersion {
+	versions := h[name]
+	for i := range versions {
+		if strings.EqualFold(versions[i].SHA256, sha) {
+			return &versions[i]
+		}
+	}
+	return nil
+}
+
+// find returns the most recently seen entry for the given version of the named mod. Versions are
+// compared numerically when possible, so that 1.2 matches 1.2.0.0.
+func (h modHistory) find(name, version string) *historicalVersion {
+	versions := h[name]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if sameVersion(versions[i].Version, version) {
+			return &versions[i]
+		}
+	}
+	return nil
+}
+
+func sameVersion(a, b string) bool {
+	va, errA := modlinks.ParseVersion(a)
+	vb, errB := modlinks.ParseVersion(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return va.Compare(vb) == 0
+}
+
+func (hv *historicalVersion) manifest(name string) modlinks.Manifest {
+	return modlinks.Manifest{
+		Name:         name,
+		Version:      hv.Version,
+		Link:         modlinks.Link{URL: hv.URL, SHA256: hv.SHA256},
+		Dependencies: hv.Dependencies,
+	}
+}
+
+// resolveVersionedMod finds the manifest for a specific version of a mod, requested as
+// name@version, either on modlinks, in the history of previous modlinks files, or among the
+// mods previously installed from modlinks.
+func resolveVersionedMod(manifests []modlinks.Manifest, h modHistory, db *installDB, request string) (modlinks.Manifest, error) {
+	i := strings.LastIndex(request, "@")
+	requestedName, version := request[:i], request[i+1:]
+	names := map[string]bool{}
+	for _, m := range manifests {
+		names[m.Name] = true
+	}
+	for name := range h {
+		names[name] = true
+	}
+	name, err := resolveModName(sortedKeys(names), requestedName)
+	if err != nil {
+		return modlinks.Manifest{}, err
+	}
+	for _, m := range manifests {
+		if m.Name == name && sameVersion(m.Version, version) {
+			return m, nil
+		}
+	}
+	if hv := h.find(name, version); hv != nil {
+		return hv.manifest(name), nil
+	}
+	if rec := db.lookup(name); rec != nil && rec.Origin == originModlinks && sameVersion(rec.Version, version) {
+		return modlinks.Manifest{
+			Name:         name,
+			Version:      rec.Version,
+			Link:         modlinks.Link{URL: rec.URL, SHA256: rec.SHA256},
+			Dependencies: rec.Dependencies,
+		}, nil
+	}
+	var known []string
+	for _, hv := range h[name] {
+		known = append(known, hv.Version)
+	}
+	sort.Slice(known, func(i, j int) bool {
+		vi, erri := modlinks.ParseVersion(known[i])
+		vj, errj := modlinks.ParseVersion(known[j])
+		if erri != nil || errj != nil {
+			return known[i] < known[j]
+		}
+		return vi.Compare(vj) < 0
+	})
+	if len(known) == 0 {
+		return modlinks.Manifest{}, fmt.Errorf("no record of %s version %s", name, version)
+	}
+	return modlinks.Manifest{}, fmt.Errorf("no record of %s version %s; known versions: %s", name, version, strings.Join(known, ", "))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+// installDBName is the name of the file, inside the Mods directory, where hkmod records
+// which versions of which mods it installed.
+const installDBName = "hkmod.json"
+
+type installDB struct {
+	Mods map[string]*installRecord `json:"mods"`
+	API  *apiRecord                `json:"api,omitempty"`
+}
+
+type installRecord struct {
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	URL         string    `json:"url"`
+	SHA256      string    `json:"sha256"`
+	InstalledAt time.Time `json:"installedAt"`
+	Origin      modOrigin `json:"origin"`
+	// Dependencies is nil if the mod's dependencies are unknown, as is the case for
+	// mods installed from a file.
+	Dependencies []modlinks.Dependency `json:"dependencies"`
+	// AsDependency is true if the mod was only installed because other mods depend on it.
+	// Mods recorded before this was tracked count as having been requested.
+	AsDependency bool `json:"asDependency,omitempty"`
+}
+
+// An apiRecord describes the installed version of the Modding API.
+type apiRecord struct {
+	Version     string    `json:"version"`
+	URL         string    `json:"url"`
+	SHA256      string    `json:"sha256"`
+	InstalledAt time.Time `json:"installedAt"`
+	// ModdedSHA256 and VanillaSHA256 are the hashes of the modded Assembly-CSharp.dll and
+	// of its backed-up vanilla counterpart, respectively. VanillaSHA256 is empty if
+	// there is no backup.
+	ModdedSHA256  string `json:"moddedSHA256"`
+	VanillaSHA256 string `json:"vanillaSHA256,omitempty"`
+}
+
+type modOrigin string
+
+const (
+	originModlinks    modOrigin = "modlinks"
+	originInstallfile modOrigin = "installfile"
+)
+
+func loadInstallDB(modsdir string) (*installDB, error) {
+	db := &installDB{}
+	content, err := os.ReadFile(filepath.Join(modsdir, installDBName))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("read install database: %w", err)
+	default:
+		if err := json.Unmarshal(content, db); err != nil {
+			return nil, fmt.Errorf("read install database: %w", err)
+		}
+	}
+	if db.Mods == nil {
+		db.Mods = map[string]*installRecord{}
+	}
+	return db, nil
+}
+
+func (db *installDB) save(modsdir string) error {
+	wrap := func(err error) error { return fmt.Errorf("write install database: %w", err) }
+	content, err := json.MarshalIndent(db, "", "\t")
+	if err != nil {
+		return wrap(err)
+	}
+	if err := writeFileAtomic(filepath.Join(modsdir, installDBName), content); err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces the contents of a file, creating it and its parent directory if
+// needed. It writes to a temporary file first so that a crash midway can't leave a truncated file
+// behind.
+func writeFileAtomic(dest string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0750); err != nil {
+		return err
+	}
+	tmp := dest + ".tmp"
+	if err := os.WriteFile(tmp, content, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// record records that a mod was installed. requested is false if the mod was installed only
+// because other mods depend on it; a mod that was previously requested stays that way.
+func (db *installDB) record(name, version string, link modlinks.Link, origin modOrigin, deps []modlinks.Dependency, requested bool) {
+	prev := db.Mods[name]
+	db.Mods[name] = &installRecord{
+		Name:         name,
+		Version:      version,
+		URL:          link.URL,
+		SHA256:       link.SHA256,
+		InstalledAt:  time.Now().UTC(),
+		Origin:       origin,
+		Dependencies: deps,
+		AsDependency: !requested && (prev == nil || prev.AsDependency),
+	}
+}
+
+// lookup returns the record for the named mod, or nil if there is none. It may be called on a nil
+// database.
+func (db *installDB) lookup(name string) *installRecord {
+	if db == nil {
+		return nil
+	}
+	return db.Mods[name]
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+type lockfile struct {
+	Mods []lockedMod `json:"mods"`
+}
+
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	var output string
+	flags.StringVar(&output, "o", "hkmod-lock.json", "Write the lockfile to `path`")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	mods, err := lockInstalledMods(modsdir, db)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(lockfile{Mods: mods}, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(output, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %d mods to %s\n", len(mods), output)
+	return nil
+}
+
+func syncLockfile(args []string) error {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	var force bool
+	flags.BoolVar(&force, "force", false, "Also remove enabled mods that are not in the lockfile and were not installed by hkmod")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) != 1 {
+		return fmt.Errorf("usage: sync [-force] lockfile")
+	}
+	content, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var lf lockfile
+	if err := json.Unmarshal(content, &lf); err != nil {
+		return fmt.Errorf("read lockfile %s: %w", args[0], err)
+	}
+	for _, lm := range lf.Mods {
+		// Without a valid hash, we can't guarantee that everyone ends up with the same files.
+		if sha, err := hex.DecodeString(lm.SHA256); err != nil || len(sha) != 32 {
+			return fmt.Errorf("read lockfile %s: %s has an invalid sha256", args[0], lm.Name)
+		}
+	}
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	cachedir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	err = syncModSet(installdir, cachedir, lf.Mods, db, force, func(mod string) error {
+		if err := removePreviousVersion(mod, installdir); err != nil {
+			return err
+		}
+		delete(db.Mods, mod)
+		fmt.Println("Yeeted", mod)
+		return nil
+	})
+	if serr := db.save(modsdir); serr != nil {
+		return serr
+	}
+	return err
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"archive/zip"
+	"bufio"
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -16,6 +18,8 @@ import (
 	"runtime"
 	"sort"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/dpinela/colophon/internal/modlinks"
@@ -24,30 +28,92 @@ import (
 const (
 	pathEnvVar        = "HK15PATH"
 	modlinksURLEnvVar = "MODLINKSURL"
+	apiLinksURLEnvVar = "APILINKSURL"
 )
 
+// offline is set by the -offline option; when true, only cached modlinks and mod files are used.
+var offline bool
+
+func usage() {
+	fmt.Printf("usage: %s [-offline] list [-s search] [-i] [-d | -json | -format template]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] install [-j n] [-code packcode] [-json] modname[@version] [...]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] installfile modname path-or-url\n", os.Args[0])
+	fmt.Printf("       %s [-offline] yeet [-cascade] [-force] [-json] modnames [...]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] autoremove [-n]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] deps [-reverse] mod\n", os.Args[0])
+	fmt.Printf("       %s [-offline] deps -dot [modnames ...]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] why mod\n", os.Args[0])
+	fmt.Printf("       %s [-offline] disable|enable modnames [...]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] profile create|switch|list|delete [name] [modnames ...]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] export [-o lockfile]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] sync [-force] lockfile\n", os.Args[0])
+	fmt.Printf("       %s [-offline] pack-code\n", os.Args[0])
+	fmt.Printf("       %s [-offline] cache list|verify|prune|clear\n", os.Args[0])
+	fmt.Printf("       %s [-offline] sources list|add|remove [-priority n] [name] [location]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] outdated\n", os.Args[0])
+	fmt.Printf("       %s [-offline] check\n", os.Args[0])
+	fmt.Printf("       %s [-offline] upgrade [modnames ...]\n", os.Args[0])
+	fmt.Printf("       %s [-offline] api install|status\n", os.Args[0])
+	fmt.Printf("       %s [-offline] vanilla|modded\n", os.Args[0])
+	fmt.Printf("       %s [-offline] publish -url modfileurl -modlinks ModLinks.xml [-name modname] [-version number] [-desc text] [-deps dep1,dep2,...] [-repo url]\n", os.Args[0])
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("usage: %s list [-s search] [-i] [-d]\n", os.Args[0])
-		fmt.Printf("       %s install modnames [...]\n", os.Args[0])
-		fmt.Printf("       %s installfile modname path-or-url", os.Args[0])
-		fmt.Printf("       %s yeet modnames [...]\n", os.Args[0])
-		fmt.Printf("       %s publish -url modfileurl -modlinks ModLinks.xml [-name modname] [-version number] [-desc text] [-deps dep1,dep2,...] [-repo url]\n", os.Args[0])
+	flag.BoolVar(&offline, "offline", false, "Use only cached modlinks and mod files")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
 		os.Exit(2)
 	}
-	subcmd := os.Args[1]
+	subcmd := flag.Arg(0)
+	args := flag.Args()[1:]
 	var err error
 	switch subcmd {
 	case "list":
-		err = list(os.Args[2:])
+		err = list(args)
 	case "install":
-		err = install(os.Args[2:])
+		err = install(args)
 	case "installfile":
-		err = installfile(os.Args[2:])
+		err = installfile(args)
 	case "yeet":
-		err = yeet(os.Args[2:])
+		err = yeet(args)
+	case "autoremove":
+		err = autoremove(args)
+	case "deps":
+		err = deps(args)
+	case "why":
+		err = why(args)
+	case "profile":
+		err = profile(args)
+	case "export":
+		err = export(args)
+	case "sync":
+		err = syncLockfile(args)
+	case "pack-code":
+		err = packCode(args)
+	case "cache":
+		err = cache(args)
+	case "sources":
+		err = sources(args)
+	case "outdated":
+		err = outdated(args)
+	case "check":
+		err = check(args)
+	case "upgrade":
+		err = upgrade(args)
+	case "api":
+		err = api(args)
+	case "disable":
+		err = disable(args)
+	case "enable":
+		err = enable(args)
+	case "vanilla":
+		err = vanilla(args)
+	case "modded":
+		err = modded(args)
 	case "publish":
-		err = publish(os.Args[2:])
+		err = publish(args)
 	default:
 		err = fmt.Errorf("unknown subcommand: %q", subcmd)
 	}
@@ -64,114 +130,412 @@ func modlinksURL() string {
 	return "https://raw.githubusercontent.com/hk-modding/modlinks/main/ModLinks.xml"
 }
 
-func install(args []string) error {
+func apiLinksURL() string {
+	if u := os.Getenv(apiLinksURLEnvVar); u != "" {
+		return u
+	}
+	return "https://raw.githubusercontent.com/hk-modding/modlinks/main/ApiLinks.xml"
+}
+
+// getModlinks fetches the mods from all modlinks sources, through the cache.
+func getModlinks() ([]modlinks.Manifest, error) {
+	manifests, _, err := getCatalog()
+	return manifests, err
+}
+
+// getAPILinks fetches the Modding API's links file, through the cache.
+func getAPILinks() (modlinks.APIManifest, error) {
+	mc, err := modlinksCache()
+	if err != nil {
+		return modlinks.APIManifest{}, err
+	}
+	return mc.GetAPI(apiLinksURL())
+}
+
+func modlinksCache() (*modlinks.Cache, error) {
+	cachedir, err := cacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return &modlinks.Cache{
+		Dir:     filepath.Join(cachedir, "modlinks"),
+		Offline: offline,
+		Warn:    func(err error) { fmt.Fprintln(os.Stderr, "warning:", err) },
+	}, nil
+}
+
+func installDir() (string, error) {
 	installdir := os.Getenv(pathEnvVar)
 	if installdir == "" {
-		return fmt.Errorf(pathEnvVar + " not defined")
+		return "", fmt.Errorf(pathEnvVar + " not defined")
 	}
-	cachedir, err := os.UserCacheDir()
+	return installdir, nil
+}
+
+func configDir() (string, error) {
+	configdir, err := os.UserConfigDir()
 	if err != nil {
-		return fmt.Errorf("cache directory not available: %w", err)
+		return "", fmt.Errorf("config directory not available: %w", err)
 	}
-	cachedir = filepath.Join(cachedir, "hkmod")
+	return filepath.Join(configdir, "hkmod"), nil
+}
 
-	manifests, err := modlinks.Get(modlinksURL())
+func cacheDir() (string, error) {
+	cachedir, err := os.UserCacheDir()
 	if err != nil {
+		return "", fmt.Errorf("cache directory not available: %w", err)
+	}
+	return filepath.Join(cachedir, "hkmod"), nil
+}
+
+func install(args []string) error {
+	flags := flag.NewFlagSet("install", flag.ExitOnError)
+	var code string
+	var jobs int
+	var jsonOut bool
+	flags.StringVar(&code, "code", "", "Install the mods in a pack `code` made by the pack-code command")
+	flags.IntVar(&jobs, "j", defaultDownloadJobs, "Download up to `n` mods at the same time")
+	flags.BoolVar(&jsonOut, "json", false, "Print a summary of what was installed in JSON format")
+	if err := flags.Parse(args); err != nil {
 		return err
 	}
+	args = flags.Args()
+	summary := newInstallSummary(messageOutput(jsonOut))
+	// Scripts get a summary even if the install can't go ahead at all.
+	stop := func(err error) error {
+		summary.Error = err.Error()
+		if jsonOut {
+			if jerr := writeJSON(summary); jerr != nil {
+				return jerr
+			}
+		}
+		return err
+	}
+	installdir, err := installDir()
+	if err != nil {
+		return stop(err)
+	}
+	cachedir, err := cacheDir()
+	if err != nil {
+		return stop(err)
+	}
+
+	manifests, err := getModlinks()
+	if err != nil {
+		return stop(err)
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return stop(err)
+	}
+	var history modHistory
 	resolvedMods := make([]string, 0, len(args))
 	for _, requestedName := range args {
-		mod, err := resolveMod(manifests, requestedName)
+		if !strings.Contains(requestedName, "@") {
+			mod, err := resolveMod(manifests, requestedName)
+			if err != nil {
+				summary.skip(requestedName, err)
+				continue
+			}
+			resolvedMods = append(resolvedMods, mod)
+			continue
+		}
+		if history == nil {
+			if history, err = loadHistory(); err != nil {
+				return stop(err)
+			}
+		}
+		pinned, err := resolveVersionedMod(manifests, history, db, requestedName)
 		if err != nil {
-			fmt.Println(err)
+			summary.skip(requestedName, err)
 			continue
 		}
-		resolvedMods = append(resolvedMods, mod)
+		// Put the requested version in place of the latest one, so that it is what gets installed
+		// alongside the dependencies.
+		manifests = replaceManifest(manifests, pinned)
+		resolvedMods = append(resolvedMods, pinned.Name)
+	}
+	if code != "" {
+		packMods, err := resolvePackCode(manifests, code, summary)
+		if err != nil {
+			return stop(err)
+		}
+		resolvedMods = append(resolvedMods, packMods...)
 	}
 
 	downloads, err := modlinks.TransitiveClosure(manifests, resolvedMods)
 	if err != nil {
-		return err
+		return stop(err)
 	}
-	for _, dl := range downloads {
+	requested := make(map[string]bool, len(resolvedMods))
+	for _, name := range resolvedMods {
+		requested[name] = true
+	}
+	installMods(installdir, cachedir, downloads, originModlinks, requested, jobs, db, summary)
+	if err := db.save(modsdir); err != nil {
+		return stop(err)
+	}
+	if jsonOut {
+		return writeJSON(summary)
+	}
+	return nil
+}
+
+// replaceManifest returns a copy of manifests with the manifest of the same name as m, if any,
+// replaced by m.
+func replaceManifest(manifests []modlinks.Manifest, m modlinks.Manifest) []modlinks.Manifest {
+	result := make([]modlinks.Manifest, 0, len(manifests)+1)
+	for _, other := range manifests {
+		if other.Name != m.Name {
+			result = append(result, other)
+		}
+	}
+	return append(result, m)
+}
+
+// defaultDownloadJobs is the number of mods downloaded at the same time, unless otherwise specified.
+const defaultDownloadJobs = 4
+
+// installMods installs each of the given mods, recording them in db as coming from origin. Mods
+// not in requested are recorded as dependencies; if requested is nil, mods keep their recorded
+// status. Either way, mods with no record count as requested if they were already installed, or
+// if requested is nil.
+// Up to jobs mods are downloaded at a time; they are then extracted one by one. Errors are
+// reported for each individual mod, and recorded in summary, which may be nil; they do not stop
+// the remaining mods from being installed.
+func installMods(installdir, cachedir string, mods []modlinks.Manifest, origin modOrigin, requested map[string]bool, jobs int, db *installDB, summary *installSummary) {
+	staged := stageMods(installdir, cachedir, mods, jobs, db, summary)
+	if staged == nil {
+		return
+	}
+	staged.commit(db, func(string) modOrigin { return origin }, requested, summary)
+}
+
+// A stagedInstall is a set of mods that have been swapped into place, but whose previous versions
+// are kept until it is committed, so that it can still be rolled back.
+type stagedInstall struct {
+	batch *installBatch
+	mods  []stagedMod
+}
+
+type stagedMod struct {
+	mod  modlinks.Manifest
+	link modlinks.Link
+}
+
+// stageMods downloads and extracts the given mods, as described for installMods, without
+// committing them. If any mod fails to extract, everything is rolled back and nil is returned.
+func stageMods(installdir, cachedir string, mods []modlinks.Manifest, jobs int, db *installDB, summary *installSummary) *stagedInstall {
+	type download struct {
+		mod  modlinks.Manifest
+		link modlinks.Link
+		file *modFile
+		err  error
+	}
+	downloads := make([]*download, 0, len(mods))
+	for _, mod := range mods {
 		// There's no way we can reasonably install a mod whose name contains a path separator.
 		// This also avoids any path traversal vulnerabilities from mod names.
-		if strings.ContainsRune(dl.Name, filepath.Separator) {
-			fmt.Printf("cannot install %s: contains path separator\n", dl.Name)
-			continue
-		}
-		if strings.ContainsRune(path.Base(dl.Link.URL), filepath.Separator) {
-			fmt.Printf("cannot install %s: filename contains path separator\n", dl.Name)
+		if strings.ContainsRune(mod.Name, filepath.Separator) {
+			summary.fail(mod.Name, errors.New("contains path separator"))
 			continue
 		}
-		file, err := getModFile(cachedir, &dl)
+		link, err := selectLink(&mod)
 		if err != nil {
-			fmt.Printf("cannot install %s: %v\n", dl.Name, err)
+			summary.fail(mod.Name, err)
 			continue
 		}
-		if err := removePreviousVersion(dl.Name, installdir); err != nil {
-			fmt.Printf("cannot install %s: %v\n", dl.Name, err)
-			file.Close()
+		if strings.ContainsRune(path.Base(link.URL), filepath.Separator) {
+			summary.fail(mod.Name, errors.New("filename contains path separator"))
 			continue
 		}
-		if file.IsZIP {
-			err = extractModZip(file, file.Size, dl.Name, installdir)
-		} else {
-			err = extractModDLL(file, path.Base(dl.Link.URL), dl.Name, installdir)
+		downloads = append(downloads, &download{mod: mod, link: link})
+	}
+	warnDependencyProblems(summary.output(), filepath.Join(installdir, "Mods"), mods, db)
+
+	if jobs < 1 {
+		jobs = 1
+	}
+	progress := newProgressView(summary.output())
+	slots := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for _, dl := range downloads {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(dl *download) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			dl.file, dl.err = getModFile(cachedir, dl.mod.Name, dl.link, progress)
+		}(dl)
+	}
+	wg.Wait()
+	progress.finish()
+
+	// Extract everything before touching any of the installed mods, so that if one of them fails
+	// we can put back everything as it was.
+	staged := &stagedInstall{batch: newInstallBatch(filepath.Join(installdir, "Mods"))}
+	for i, dl := range downloads {
+		if dl.err != nil {
+			summary.fail(dl.mod.Name, dl.err)
+			continue
 		}
-		file.Close()
+		err := installModFile(staged.batch, dl.file, path.Base(dl.link.URL), dl.mod.Name)
+		dl.file.Close()
+		dl.file = nil
 		if err != nil {
-			fmt.Printf("cannot install %s: %v\n", dl.Name, err)
+			summary.fail(dl.mod.Name, err)
+			staged.batch.rollback()
+			for _, other := range staged.mods {
+				summary.rollBack(other.mod.Name, dl.mod.Name)
+			}
+			for _, other := range downloads[i+1:] {
+				if other.err != nil {
+					summary.fail(other.mod.Name, other.err)
+					continue
+				}
+				other.file.Close()
+				summary.rollBack(other.mod.Name, dl.mod.Name)
+			}
+			summary.printf("No mods were changed.\n")
+			return nil
 		}
+		staged.mods = append(staged.mods, stagedMod{mod: dl.mod, link: dl.link})
 	}
-	return nil
+	return staged
+}
+
+// commit deletes the previous versions of the staged mods and records them in db, as described
+// for installMods.
+func (s *stagedInstall) commit(db *installDB, origin func(name string) modOrigin, requested map[string]bool, summary *installSummary) {
+	// Mods that were already installed without hkmod's knowledge were put there by another tool,
+	// or by an older version of hkmod, at the user's request; autoremove mustn't treat them as
+	// mere dependencies.
+	replaced := s.batch.replacedMods()
+	s.batch.commit()
+	for _, sm := range s.mods {
+		name := sm.mod.Name
+		isRequested := requested[name] || (db.lookup(name) == nil && (requested == nil || replaced[name]))
+		db.record(name, sm.mod.Version, sm.link, origin(name), append([]modlinks.Dependency{}, sm.mod.Dependencies...), isRequested)
+		summary.install(name, sm.mod.Version)
+	}
+}
+
+// rollback puts back the previous versions of the staged mods.
+func (s *stagedInstall) rollback(summary *installSummary) {
+	s.batch.rollback()
+	for _, sm := range s.mods {
+		summary.rollBack(sm.mod.Name, "another mod")
+	}
+	summary.printf("No mods were changed.\n")
+}
+
+// installModFile extracts a mod into a staging directory, and then swaps it in for the previous
+// version as part of batch.
+func installModFile(batch *installBatch, file *modFile, filename, name string) error {
+	staging, err := batch.stage(name)
+	if err != nil {
+		return err
+	}
+	if file.IsZIP {
+		err = extractModZip(file, file.Size, name, staging)
+	} else {
+		err = extractModDLL(file, filename, name, staging)
+	}
+	if err != nil {
+		if rerr := os.RemoveAll(staging); rerr != nil {
+			fmt.Fprintln(os.Stderr, "warning:", rerr)
+		}
+		return err
+	}
+	return batch.swap(name, staging)
 }
 
 func installfile(args []string) error {
-	installdir := os.Getenv(pathEnvVar)
-	if installdir == "" {
-		return fmt.Errorf(pathEnvVar + " not defined")
+	installdir, err := installDir()
+	if err != nil {
+		return err
 	}
 	if len(args) < 2 {
 		return fmt.Errorf("usage: installfile modname path-or-url")
 	}
 	name := args[0]
 	source := args[1]
-	var file interface {
-		io.ReadSeeker
-		io.ReaderAt
+	if modlinks.IsFileURL(source) {
+		localPath, err := modlinks.FileURLPath(source)
+		if err != nil {
+			return err
+		}
+		source = localPath
 	}
-	var size int64
-	if regexp.MustCompile("^https?://").MatchString(source) {
-		resp, err := http.Get(source)
+	isURL := regexp.MustCompile("^https?://").MatchString(source)
+	var file *modFile
+	if isURL {
+		cachedir, err := cacheDir()
 		if err != nil {
-			return fmt.Errorf("download %s: %w", source, err)
+			return err
 		}
-		content, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
+		file, err = getURLFile(cachedir, source)
 		if err != nil {
-			return fmt.Errorf("download %s: %w", source, err)
+			return err
 		}
-		size = int64(len(content))
-		file = bytes.NewReader(content)
 	} else {
 		f, err := os.Open(source)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
 		info, err := f.Stat()
 		if err != nil {
+			f.Close()
 			return err
 		}
-		size = info.Size()
-		file = f
+		file = &modFile{File: f, Size: info.Size()}
 	}
-	if path.Ext(source) == ".zip" {
-		return extractModZip(file, size, name, installdir)
-	} else {
-		return extractModDLL(file, path.Base(source), name, installdir)
+	defer file.Close()
+	file.IsZIP = path.Ext(source) == ".zip"
+	sha, err := sha256OfReader(file)
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	batch := newInstallBatch(modsdir)
+	if err := installModFile(batch, file, path.Base(source), name); err != nil {
+		return err
+	}
+	batch.commit()
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	if !isURL {
+		if abs, err := filepath.Abs(source); err == nil {
+			source = abs
+		}
 	}
+	db.record(name, versionFromURL(source), modlinks.Link{URL: source, SHA256: sha}, originInstallfile, nil, true)
+	return db.save(modsdir)
+}
+
+func sha256OfFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return sha256OfReader(f)
+}
+
+func sha256OfReader(r io.ReadSeeker) (string, error) {
+	sha := sha256.New()
+	if _, err := io.Copy(sha, r); err != nil {
+		return "", err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sha.Sum(make([]byte, 0, sha256.Size))), nil
 }
 
 type unknownModError struct{ requestedName string }
@@ -267,14 +631,18 @@ func selectLink(mod *modlinks.Manifest) (modlinks.Link, error) {
 	if mod.OSLinks == nil {
 		return modlinks.Link{}, fmt.Errorf("no general or platform-specific link specified")
 	}
+	return selectOSLink(mod.OSLinks)
+}
+
+func selectOSLink(links *modlinks.OSLinkSet) (modlinks.Link, error) {
 	var osLink modlinks.Link
 	switch runtime.GOOS {
 	case "windows":
-		osLink = mod.OSLinks.Windows
+		osLink = links.Windows
 	case "darwin":
-		osLink = mod.OSLinks.Mac
+		osLink = links.Mac
 	case "linux":
-		osLink = mod.OSLinks.Linux
+		osLink = links.Linux
 	}
 	var err error
 	if osLink.SHA256 == "" {
@@ -289,53 +657,113 @@ type modFile struct {
 	IsZIP bool
 }
 
-func getModFile(cachedir string, mod *modlinks.Manifest) (*modFile, error) {
-	link, err := selectLink(mod)
-	if err != nil {
-		return nil, err
-	}
+var errNotCached = errors.New("not in the download cache, and cannot download in offline mode")
+
+// getModFile returns the file pointed to by link, downloading it if it is not already in the cache.
+// Cache entries are named after their hash, so that any number of versions of a mod can be
+// cached at the same time, and checking whether a file is cached does not require hashing it.
+func getModFile(cachedir, name string, link modlinks.Link, progress *progressView) (*modFile, error) {
 	expectedSHA, err := hex.DecodeString(link.SHA256)
 	if err != nil {
 		return nil, err
 	}
-	ext := path.Ext(link.URL)
-	cacheEntry := filepath.Join(cachedir, mod.Name+ext)
-	f, err := os.Open(cacheEntry)
+	if len(expectedSHA) != sha256.Size {
+		return nil, fmt.Errorf("invalid sha256: %s", link.SHA256)
+	}
+	if modlinks.IsFileURL(link.URL) {
+		progress.println("=> Installing", name, "from", link.URL)
+		return openLocalLink(link.URL, expectedSHA)
+	}
+	cacheEntry := filepath.Join(cachedir, cacheEntryName(link.SHA256, link.URL))
+	f, err := openCacheEntry(cacheEntry)
 	if os.IsNotExist(err) {
-		fmt.Println("=> Installing", mod.Name, "from", link.URL)
-		return downloadLink(cacheEntry, link.URL, expectedSHA)
+		if offline {
+			return nil, errNotCached
+		}
+		progress.println("=> Installing", name, "from", link.URL)
+		f, err = downloadLink(cacheEntry, link.URL, expectedSHA, progress)
+		if err == nil {
+			recordCachedURL(cachedir, link.URL, filepath.Base(cacheEntry))
+		}
+		return f, err
 	}
 	if err != nil {
 		return nil, err
 	}
-	sha := sha256.New()
-	size, err := io.Copy(sha, f)
+	progress.println("=> Installing", name, "from cache")
+	return f, nil
+}
+
+// openLocalLink opens the file pointed to by a file:// URL, checking that it matches expectedSHA.
+// Such files are already local, so they are not cached.
+func openLocalLink(fileURL string, expectedSHA []byte) (*modFile, error) {
+	wrap := func(err error) error { return fmt.Errorf("open %s: %w", fileURL, err) }
+	localPath, err := modlinks.FileURLPath(fileURL)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	info, err := f.Stat()
 	if err != nil {
 		f.Close()
-		return nil, err
+		return nil, wrap(err)
+	}
+	sha, err := sha256OfReader(f)
+	if err != nil {
+		f.Close()
+		return nil, wrap(err)
 	}
-	if !bytes.Equal(expectedSHA, sha.Sum(make([]byte, 0, sha256.Size))) {
+	if sha != hex.EncodeToString(expectedSHA) {
 		f.Close()
-		fmt.Println("=> Installing", mod.Name, "from", link.URL)
-		return downloadLink(cacheEntry, link.URL, expectedSHA)
+		return nil, wrap(errors.New("sha256 does not match manifest"))
 	}
-	fmt.Println("=> Installing", mod.Name, "from cache")
-	return &modFile{File: f, Size: size, IsZIP: ext == ".zip"}, nil
+	return &modFile{File: f, Size: info.Size(), IsZIP: filepath.Ext(localPath) == ".zip"}, nil
 }
 
-func isatty(f *os.File) bool {
+// openCacheEntry opens a file in the cache, marking it as recently used.
+func openCacheEntry(cacheEntry string) (*modFile, error) {
+	f, err := os.Open(cacheEntry)
+	if err != nil {
+		return nil, err
+	}
 	info, err := f.Stat()
 	if err != nil {
-		return false
+		f.Close()
+		return nil, err
 	}
-	return info.Mode()&os.ModeCharDevice != 0
+	// Keep track of when each cache entry was last used, so that old ones can be pruned.
+	now := time.Now()
+	if err := os.Chtimes(cacheEntry, now, now); err != nil {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
+	return &modFile{File: f, Size: info.Size(), IsZIP: filepath.Ext(cacheEntry) == ".zip"}, nil
 }
 
-const ansiEraseLine = "\x1b[G\x1b[K"
-
-func downloadLink(localfile string, url string, expectedSHA []byte) (*modFile, error) {
+// getURLFile returns the file at url, which is not known in advance to have any particular hash.
+// The file is still cached, so that it can be reused by later installs of the same file from
+// modlinks, or of the same URL in offline mode; otherwise it is downloaded again, since what the
+// URL points to may have changed.
+func getURLFile(cachedir, url string) (*modFile, error) {
 	wrap := func(err error) error { return fmt.Errorf("download %s: %w", url, err) }
-
+	if offline {
+		entry := lookupCachedURL(cachedir, url)
+		if entry == "" {
+			return nil, errNotCached
+		}
+		f, err := openCacheEntry(filepath.Join(cachedir, entry))
+		if os.IsNotExist(err) {
+			return nil, errNotCached
+		}
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("=> Installing from cache")
+		return f, nil
+	}
+	fmt.Println("=> Installing from", url)
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, wrap(err)
@@ -344,52 +772,159 @@ func downloadLink(localfile string, url string, expectedSHA []byte) (*modFile, e
 	if !isHTTPOK(resp.StatusCode) {
 		return nil, fmt.Errorf("download %s: response status was %d", url, resp.StatusCode)
 	}
-	if err := os.MkdirAll(filepath.Dir(localfile), 0750); err != nil {
+	if err := os.MkdirAll(cachedir, 0750); err != nil {
 		return nil, wrap(err)
 	}
-	f, err := os.Create(localfile)
+	tmp, err := os.CreateTemp(cachedir, "download-*.part")
 	if err != nil {
 		return nil, wrap(err)
 	}
-
+	defer os.Remove(tmp.Name())
 	sha := sha256.New()
-	r := io.TeeReader(resp.Body, sha)
-	if isatty(os.Stdout) {
-		defer fmt.Print(ansiEraseLine)
-		var counter byteCounter
-		counter.updatePeriod = time.Second
-		if fullSize := dataSize(resp.ContentLength); fullSize != -1 {
-			counter.update = func(n dataSize) { fmt.Printf(ansiEraseLine+"downloading: %s of %s", n, fullSize) }
-		} else {
-			counter.update = func(n dataSize) { fmt.Printf(ansiEraseLine+"downloading: %s of ???", n) }
-		}
-		r = io.TeeReader(r, &counter)
+	_, err = io.Copy(tmp, io.TeeReader(resp.Body, sha))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
 	}
-	size, err := io.Copy(f, r)
 	if err != nil {
-		f.Close()
 		return nil, wrap(err)
 	}
-	if !bytes.Equal(sha.Sum(make([]byte, 0, sha256.Size)), expectedSHA) {
-		return nil, fmt.Errorf("download %s: sha256 does not match manifest", url)
+	entry := cacheEntryName(hex.EncodeToString(sha.Sum(make([]byte, 0, sha256.Size))), url)
+	if err := os.Rename(tmp.Name(), filepath.Join(cachedir, entry)); err != nil {
+		return nil, wrap(err)
 	}
-	return &modFile{File: f, Size: size, IsZIP: path.Ext(url) == ".zip"}, nil
+	recordCachedURL(cachedir, url, entry)
+	return openCacheEntry(filepath.Join(cachedir, entry))
+}
+
+func isatty(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
-type byteCounter struct {
-	bytesWritten dataSize
-	lastUpdate   time.Time
-	updatePeriod time.Duration
-	update       func(dataSize)
+const (
+	downloadAttempts   = 5
+	downloadRetryDelay = time.Second
+)
+
+// downloadLink downloads url into localfile, checking that it matches expectedSHA. The download is
+// written to a separate partial file first and only moved into place once it has been verified, so
+// that an interrupted download never leaves a corrupt file behind; the next attempt resumes from
+// where the previous one left off, if the server allows it.
+func downloadLink(localfile string, url string, expectedSHA []byte, progress *progressView) (*modFile, error) {
+	wrap := func(err error) error { return fmt.Errorf("download %s: %w", url, err) }
+
+	if err := os.MkdirAll(filepath.Dir(localfile), 0750); err != nil {
+		return nil, wrap(err)
+	}
+	partfile := localfile + ".part"
+	delay := downloadRetryDelay
+	for attempt := 1; ; attempt++ {
+		resumed, err := downloadToFile(partfile, url, progress)
+		if err == nil {
+			var sha string
+			sha, err = sha256OfFile(partfile)
+			if err == nil && sha != hex.EncodeToString(expectedSHA) {
+				if rerr := os.Remove(partfile); rerr != nil {
+					progress.println("warning:", rerr)
+				}
+				err = errors.New("sha256 does not match manifest")
+				// The partial file may have been left over from some other version of the
+				// file; it's worth trying again from scratch.
+				if resumed {
+					err = &transientError{err}
+				}
+			}
+		}
+		if err == nil {
+			break
+		}
+		var te *transientError
+		if !errors.As(err, &te) || attempt == downloadAttempts {
+			return nil, wrap(err)
+		}
+		progress.println(fmt.Sprintf("warning: download %s failed (%v), retrying in %v", url, err, delay))
+		time.Sleep(delay)
+		delay *= 2
+	}
+	if err := os.Rename(partfile, localfile); err != nil {
+		return nil, wrap(err)
+	}
+	f, err := os.Open(localfile)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, wrap(err)
+	}
+	return &modFile{File: f, Size: info.Size(), IsZIP: path.Ext(url) == ".zip"}, nil
 }
 
-func (bc *byteCounter) Write(p []byte) (int, error) {
-	bc.bytesWritten += dataSize(len(p))
-	if now := time.Now(); now.Sub(bc.lastUpdate) > bc.updatePeriod {
-		bc.lastUpdate = now
-		bc.update(bc.bytesWritten)
+// A transientError is a download failure that may go away if we try again.
+type transientError struct{ err error }
+
+func (err *transientError) Error() string { return err.err.Error() }
+
+func (err *transientError) Unwrap() error { return err.err }
+
+// downloadToFile downloads url into partfile, appending to whatever is already there if the
+// server supports range requests. It reports whether the download was resumed in that way.
+func downloadToFile(partfile, url string, progress *progressView) (resumed bool, err error) {
+	var offset int64
+	if info, err := os.Stat(partfile); err == nil {
+		offset = info.Size()
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, &transientError{err}
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	statusErr := fmt.Errorf("response status was %d", resp.StatusCode)
+	switch code := resp.StatusCode; {
+	case code == http.StatusPartialContent && offset > 0:
+		if !strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			os.Remove(partfile)
+			return false, &transientError{fmt.Errorf("server sent the wrong range")}
+		}
+		flags = os.O_WRONLY | os.O_APPEND
+		resumed = true
+	case code == http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is at least as big as the whole file, so it can't be right.
+		os.Remove(partfile)
+		return false, &transientError{statusErr}
+	case isHTTPOK(code):
+	case code >= 500 || code == http.StatusTooManyRequests:
+		return false, &transientError{statusErr}
+	default:
+		return false, statusErr
+	}
+	f, err := os.OpenFile(partfile, flags, 0640)
+	if err != nil {
+		return false, err
+	}
+	counter := progress.start(resp.ContentLength)
+	defer counter.finish()
+	_, err = io.Copy(f, io.TeeReader(resp.Body, counter))
+	if cerr := f.Close(); err == nil && cerr != nil {
+		return resumed, cerr
 	}
-	return len(p), nil
+	if err != nil {
+		return resumed, &transientError{err}
+	}
+	return resumed, nil
 }
 
 type dataSize int64
@@ -440,14 +975,15 @@ func removePreviousDLLs(name, installdir string) error {
 	for _, e := range entries {
 		if !e.IsDir() && filepath.Ext(e.Name()) == ".dll" {
 			if err := os.Remove(filepath.Join(moddir, e.Name())); err != nil {
-				fmt.Println("warning:", err)
+				fmt.Fprintln(os.Stderr, "warning:", err)
 			}
 		}
 	}
 	return nil
 }
 
-func extractModZip(zipfile io.ReaderAt, size int64, name, installdir string) error {
+// extractModZip extracts the named mod into moddir.
+func extractModZip(zipfile io.ReaderAt, size int64, name, moddir string) error {
 	wrap := func(err error) error { return fmt.Errorf("extract mod %s: %w", name, err) }
 	archive, err := zip.NewReader(zipfile, size)
 	if err != nil {
@@ -456,7 +992,7 @@ func extractModZip(zipfile io.ReaderAt, size int64, name, installdir string) err
 	for _, file := range archive.File {
 		// Prevent us from accidentally (or not so accidentally, in case of a malicious input)
 		// from writing outside the destination directory.
-		dest := filepath.Join(installdir, "Mods", name, filepath.Join(string(filepath.Separator), filepath.FromSlash(file.Name)))
+		dest := filepath.Join(moddir, filepath.Join(string(filepath.Separator), filepath.FromSlash(file.Name)))
 		if strings.HasSuffix(file.Name, "/") {
 			err = os.MkdirAll(dest, 0750)
 		} else {
@@ -469,9 +1005,10 @@ func extractModZip(zipfile io.ReaderAt, size int64, name, installdir string) err
 	return nil
 }
 
-func extractModDLL(dllfile io.ReadSeeker, filename, modname, installdir string) error {
+// extractModDLL copies a mod consisting of a single DLL file into moddir.
+func extractModDLL(dllfile io.ReadSeeker, filename, modname, moddir string) error {
 	wrap := func(err error) error { return fmt.Errorf("extract mod %s: %w", modname, err) }
-	dest := filepath.Join(installdir, "Mods", modname, filename)
+	dest := filepath.Join(moddir, filename)
 	if err := os.MkdirAll(filepath.Dir(dest), 0750); err != nil {
 		return wrap(err)
 	}
@@ -520,7 +1057,7 @@ func writeZipFile(dest string, file *zip.File) error {
 		return err
 	}
 	if err := os.Chtimes(dest, file.Modified, file.Modified); err != nil {
-		fmt.Println("warning:", err)
+		fmt.Fprintln(os.Stderr, "warning:", err)
 	}
 	return nil
 }
@@ -529,47 +1066,90 @@ func list(args []string) error {
 	flags := flag.NewFlagSet("list", flag.ExitOnError)
 	var detailed bool
 	var installed bool
-	var search string
+	var jsonOut bool
+	var search, format string
 	flags.BoolVar(&detailed, "d", false, "Display detailed information about mods")
 	flags.BoolVar(&installed, "i", false, "Show only info on installed mods")
+	flags.BoolVar(&jsonOut, "json", false, "Print full information about mods, including installed versions, in JSON format")
 	flags.StringVar(&search, "s", "", "Search for mods whose name contains `term`")
+	flags.StringVar(&format, "format", "", "Print each mod using the given Go `template`, applied to its modlinks manifest")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	manifests, err := modlinks.Get(modlinksURL())
+	var tmpl *template.Template
+	if format != "" {
+		if detailed || jsonOut {
+			return fmt.Errorf("-format cannot be combined with -d or -json")
+		}
+		var err error
+		if tmpl, err = parseListFormat(format); err != nil {
+			return err
+		}
+	}
+	manifests, conflicts, err := getCatalog()
 	if err != nil {
 		return err
 	}
+	const placeholder = "N/A"
+	alsoDefinedBy := make(map[string][]string, len(conflicts))
+	for _, c := range conflicts {
+		alsoDefinedBy[c.Name] = c.Sources[1:]
+	}
+
 	var modFilter filter
-	if installed {
-		installdir := os.Getenv(pathEnvVar)
-		if installdir == "" {
-			return fmt.Errorf(pathEnvVar + " not defined")
-		}
-		mods, err := installedMods(filepath.Join(installdir, "Mods"))
-		if err != nil {
+	var db *installDB
+	var modSet map[string]bool
+	disabled := map[string]bool{}
+	unlisted := map[string]bool{}
+	// The JSON output always includes the installed state of each mod, but doesn't require it.
+	if installed || jsonOut {
+		var mods, disabledList []string
+		installdir, err := installDir()
+		if err == nil {
+			modsdir := filepath.Join(installdir, "Mods")
+			mods, err = installedMods(modsdir)
+			if err != nil {
+				return err
+			}
+			db, err = loadInstallDB(modsdir)
+			if err != nil {
+				return err
+			}
+			disabledList, err = disabledMods(modsdir)
+			if err != nil {
+				return err
+			}
+		} else if installed {
 			return err
 		}
-		modSet := make(map[string]bool, len(mods))
+		modSet = make(map[string]bool, len(mods)+len(disabledList))
 		for _, im := range mods {
 			modSet[im] = false
 		}
+		for _, dm := range disabledList {
+			if _, ok := modSet[dm]; !ok {
+				modSet[dm] = false
+				disabled[dm] = true
+			}
+		}
+	}
+	if installed {
 		for _, m := range manifests {
 			if _, ok := modSet[m.Name]; ok {
 				modSet[m.Name] = true
 			}
 		}
 
-		const placeholder = "N/A"
-
 		for im, hasManifest := range modSet {
 			if !hasManifest {
+				unlisted[im] = true
 				manifests = append(manifests, modlinks.Manifest{
 					Name:         im,
 					Description:  placeholder,
 					Version:      placeholder,
-					Dependencies: []string{placeholder},
+					Dependencies: []modlinks.Dependency{{Name: placeholder}},
 					Repository:   placeholder,
+					Source:       placeholder,
 				})
 			}
 		}
@@ -592,14 +1172,68 @@ func list(args []string) error {
 		}
 	}
 	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Name < filtered[j].Name })
+	if jsonOut {
+		entries := make([]listEntry, len(filtered))
+		for i := range filtered {
+			m := &filtered[i]
+			if unlisted[m.Name] {
+				entries[i] = listEntry{Name: m.Name, Dependencies: []jsonDependency{}}
+			} else {
+				entries[i] = newListEntry(m, alsoDefinedBy[m.Name])
+			}
+			if _, ok := modSet[m.Name]; ok {
+				state := &installedState{Enabled: !disabled[m.Name]}
+				if rec := db.lookup(m.Name); rec != nil {
+					state.Version = rec.Version
+					state.SHA256 = rec.SHA256
+					state.AsDependency = rec.AsDependency
+				}
+				entries[i].Installed = state
+			}
+		}
+		return writeJSON(entries)
+	}
+	if tmpl != nil {
+		out := bufio.NewWriter(os.Stdout)
+		for i := range filtered {
+			if err := tmpl.Execute(out, &filtered[i]); err != nil {
+				return err
+			}
+			out.WriteByte('\n')
+		}
+		return out.Flush()
+	}
 	for _, m := range filtered {
-		fmt.Println(m.Name)
+		if disabled[m.Name] {
+			fmt.Println(m.Name, "(disabled)")
+		} else {
+			fmt.Println(m.Name)
+		}
 		if detailed {
-			fmt.Println("\tVersion:", m.Version)
+			version := m.Version
+			if rec := db.lookup(m.Name); rec != nil {
+				version = rec.Version
+				if version == "" {
+					version = "unknown"
+				}
+				if m.Version != placeholder && m.Version != rec.Version {
+					version += " (latest: " + m.Version + ")"
+				}
+			}
+			fmt.Println("\tVersion:", version)
 			fmt.Println("\tRepository:", m.Repository)
+			source := m.Source
+			if others := alsoDefinedBy[m.Name]; len(others) > 0 {
+				source += " (also in " + strings.Join(others, ", ") + ")"
+			}
+			fmt.Println("\tSource:", source)
 			deps := "none"
 			if len(m.Dependencies) > 0 {
-				deps = strings.Join(m.Dependencies, ", ")
+				descs := make([]string, len(m.Dependencies))
+				for i, d := range m.Dependencies {
+					descs[i] = d.String()
+				}
+				deps = strings.Join(descs, ", ")
 			}
 			fmt.Println("\tDependencies:", deps)
 			fmt.Printf("\t%s\n\n", strings.ReplaceAll(m.Description, "\n", "\n\t"))
@@ -628,36 +1262,133 @@ func (f filter) test(x string) bool {
 }
 
 func yeet(args []string) error {
-	installdir := os.Getenv(pathEnvVar)
-	if installdir == "" {
-		return fmt.Errorf(pathEnvVar + " not defined")
+	flags := flag.NewFlagSet("yeet", flag.ExitOnError)
+	var cascade, force, jsonOut bool
+	flags.BoolVar(&cascade, "cascade", false, "Also yeet the installed mods that depend on the named ones")
+	flags.BoolVar(&force, "force", false, "Yeet the named mods even if other installed mods depend on them")
+	flags.BoolVar(&jsonOut, "json", false, "Print a summary of what was yeeted in JSON format")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	out := messageOutput(jsonOut)
+	summary := newYeetSummary()
+	stop := func(err error) error {
+		summary.Error = err.Error()
+		if jsonOut {
+			if jerr := writeJSON(summary); jerr != nil {
+				return jerr
+			}
+		}
+		return err
+	}
+	installdir, err := installDir()
+	if err != nil {
+		return stop(err)
 	}
 	modsdir := filepath.Join(installdir, "Mods")
 	mods, err := installedMods(modsdir)
 	if err != nil {
-		return err
+		return stop(err)
 	}
-	modsToDelete := map[string]struct{}{}
+	modsToDelete := map[string]bool{}
 	for _, arg := range args {
 		resolved, err := resolveModName(mods, arg)
 		if err != nil {
-			fmt.Println(err)
+			fmt.Fprintln(out, err)
+			summary.Skipped = append(summary.Skipped, modOutcome{Name: arg, Reason: err.Error()})
 			continue
 		}
-		modsToDelete[resolved] = struct{}{}
+		modsToDelete[resolved] = true
+	}
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return stop(err)
+	}
+	// Disabled mods still need their dependencies once they are re-enabled, so they count as
+	// dependents too.
+	disabledList, err := disabledMods(modsdir)
+	if err != nil {
+		return stop(err)
 	}
-	for mod := range modsToDelete {
-		if err := removePreviousVersion(mod, installdir); err != nil {
-			fmt.Println(err)
-		} else if mod == customKnightName {
-			fmt.Println("Yeeted", mod, "(installed skins kept)")
+	isEnabled := make(map[string]bool, len(mods))
+	for _, name := range mods {
+		isEnabled[name] = true
+	}
+	if !force {
+		manifests, err := getModlinks()
+		if err != nil {
+			fmt.Fprintf(out, "warning: %v; using only the dependencies recorded at install time\n", err)
+		}
+		deps := installedDependencyGraph(append(append([]string{}, mods...), disabledList...), db, manifests)
+		if cascade {
+			for _, name := range deps.dependents(modsToDelete) {
+				modsToDelete[name] = true
+			}
 		} else {
-			fmt.Println("Yeeted", mod)
+			var problems []string
+			for _, mod := range sortedKeys(modsToDelete) {
+				// Dependents that are being yeeted as well don't count.
+				var needed []string
+				for _, name := range deps.dependents(map[string]bool{mod: true}) {
+					if !modsToDelete[name] {
+						needed = append(needed, name)
+					}
+				}
+				if len(needed) > 0 {
+					problem := fmt.Sprintf("%s is needed by %s", mod, strings.Join(needed, ", "))
+					problems = append(problems, problem)
+					summary.Failed = append(summary.Failed, modOutcome{Name: mod, Reason: problem})
+				}
+			}
+			if len(problems) > 0 {
+				return stop(fmt.Errorf("cannot yeet: %s\nuse -cascade to yeet those mods as well, or -force to yeet anyway", strings.Join(problems, "; ")))
+			}
+		}
+	}
+	for _, mod := range sortedKeys(modsToDelete) {
+		remove := removePreviousVersion
+		if !isEnabled[mod] {
+			remove = removeDisabledMod
+		}
+		if err := remove(mod, installdir); err != nil {
+			fmt.Fprintln(out, err)
+			summary.Failed = append(summary.Failed, modOutcome{Name: mod, Reason: err.Error()})
+			continue
+		}
+		removed := modOutcome{Name: mod}
+		if rec := db.lookup(mod); rec != nil {
+			removed.Version = rec.Version
+		}
+		summary.Removed = append(summary.Removed, removed)
+		delete(db.Mods, mod)
+		switch {
+		case !isEnabled[mod]:
+			fmt.Fprintln(out, "Yeeted", mod, "(disabled)")
+		case mod == customKnightName:
+			fmt.Fprintln(out, "Yeeted", mod, "(installed skins kept)")
+		default:
+			fmt.Fprintln(out, "Yeeted", mod)
 		}
 	}
+	if err := db.save(modsdir); err != nil {
+		return stop(err)
+	}
+	if jsonOut {
+		return writeJSON(summary)
+	}
 	return nil
 }
 
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func installedMods(modsdir string) ([]string, error) {
 	wrap := func(err error) error {
 		return fmt.Errorf("list installed mods: %w", err)
@@ -675,7 +1406,7 @@ func installedMods(modsdir string) ([]string, error) {
 	// We expect almost all of the entries in the Mods directory to be actual mods.
 	modnames := make([]string, 0, len(entries))
 	for _, e := range entries {
-		if e.IsDir() && !strings.EqualFold(strings.TrimSpace(e.Name()), "Disabled") {
+		if e.IsDir() && !strings.EqualFold(strings.TrimSpace(e.Name()), disabledDirName) && !isBatchDir(e.Name()) {
 			modnames = append(modnames, e.Name())
 		}
 	}
@@ -707,20 +1438,25 @@ func publish(args []string) error {
 		return fmt.Errorf("publish %q: name could not be determined from URL", manifestPatch.Link.URL)
 	}
 	if manifestPatch.Version == "" {
-		m := regexp.MustCompile(`/v(\d+(?:\.\d+)*)/`).FindStringSubmatch(manifestPatch.Link.URL)
-		if m == nil {
+		manifestPatch.Version = versionFromURL(manifestPatch.Link.URL)
+		if manifestPatch.Version == "" {
 			return fmt.Errorf("publish %q: version could not be determined from URL", manifestPatch.Name)
 		}
-		manifestPatch.Version = m[1]
 	}
 	manifestPatch.Version = padVersion(manifestPatch.Version)
 	switch deps {
 	case "none":
-		manifestPatch.Dependencies = make([]string, 0)
+		manifestPatch.Dependencies = make([]modlinks.Dependency, 0)
 	case "":
 		manifestPatch.Dependencies = nil
 	default:
-		manifestPatch.Dependencies = strings.Split(deps, ",")
+		for _, text := range strings.Split(deps, ",") {
+			dep, err := modlinks.ParseDependency(text)
+			if err != nil {
+				return fmt.Errorf("publish %q: %w", manifestPatch.Name, err)
+			}
+			manifestPatch.Dependencies = append(manifestPatch.Dependencies, dep)
+		}
 	}
 
 	wrap := func(err error) error {
@@ -798,7 +1534,22 @@ func mustSeek(f io.Seeker, target int64) error {
 	return nil
 }
 
+// versionFromURL extracts a mod version from a release URL, such as those generated by
+// GitHub releases. It returns the empty string if the URL contains no recognizable version.
+func versionFromURL(url string) string {
+	m := regexp.MustCompile(`/v(\d+(?:\.\d+)*)/`).FindStringSubmatch(url)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// padVersion extends a version number to the four components that modlinks uses. Versions that
+// aren't numeric are padded as they are.
 func padVersion(v string) string {
+	if version, err := modlinks.ParseVersion(v); err == nil {
+		return version.Pad(4).String()
+	}
 	nums := strings.Split(v, ".")
 	for len(nums) < 4 {
 		nums = append(nums, "0")
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+// writeTestMod creates a mod directory containing the given files, mapping each file's path
+// relative to the mod directory to its contents.
+func writeTestMod(t *testing.T, moddir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(moddir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// stageTestMod stages a new version of a mod, containing the given files, as part of batch.
+func stageTestMod(t *testing.T, batch *installBatch, name string, files map[string]string) {
+	t.Helper()
+	staging, err := batch.stage(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestMod(t, staging, files)
+	if err := batch.swap(name, staging); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCommitRecordsRequestedStatus(t *testing.T) {
+	cases := []struct {
+		desc string
+		// installed is true if some version of the mod is already in the Mods directory.
+		installed bool
+		// record is the mod's existing record, if any.
+		record        *installRecord
+		requested     map[string]bool
+		wantRequested bool
+	}{
+		{desc: "new mod, requested", requested: map[string]bool{"Mod": true}, wantRequested: true},
+		{desc: "new mod, as a dependency", requested: map[string]bool{"App": true}, wantRequested: false},
+		{desc: "mod installed by another tool, as a dependency", installed: true, requested: map[string]bool{"App": true}, wantRequested: true},
+		{desc: "recorded dependency", installed: true, record: &installRecord{AsDependency: true}, requested: map[string]bool{"App": true}, wantRequested: false},
+		{desc: "recorded requested mod, as a dependency", installed: true, record: &installRecord{}, requested: map[string]bool{"App": true}, wantRequested: true},
+		{desc: "recorded dependency, now requested", installed: true, record: &installRecord{AsDependency: true}, requested: map[string]bool{"Mod": true}, wantRequested: true},
+		{desc: "new mod, keeping status", requested: nil, wantRequested: true},
+		{desc: "recorded dependency, keeping status", installed: true, record: &installRecord{AsDependency: true}, requested: nil, wantRequested: false},
+		{desc: "new mod, only upgrading", requested: map[string]bool{}, wantRequested: false},
+		{desc: "mod installed by another tool, only upgrading", installed: true, requested: map[string]bool{}, wantRequested: true},
+	}
+	for _, c := range cases {
+		modsdir := t.TempDir()
+		if c.installed {
+			writeTestMod(t, filepath.Join(modsdir, "Mod"), map[string]string{"Mod.dll": "old"})
+		}
+		db := &installDB{Mods: map[string]*installRecord{}}
+		if c.record != nil {
+			db.Mods["Mod"] = c.record
+		}
+		batch := newInstallBatch(modsdir)
+		stageTestMod(t, batch, "Mod", map[string]string{"Mod.dll": "new"})
+		staged := &stagedInstall{batch: batch, mods: []stagedMod{{mod: modlinks.Manifest{Name: "Mod", Version: "1.0"}}}}
+		staged.commit(db, func(string) modOrigin { return originModlinks }, c.requested, nil)
+		if got := db.isRequested("Mod"); got != c.wantRequested {
+			t.Errorf("%s: requested = %v, want %v", c.desc, got, c.wantRequested)
+		}
+	}
+}
+
+func TestReinstalledUnrecordedModIsNotOrphaned(t *testing.T) {
+	// Lib was installed by another tool; installing App, which depends on it, reinstalls it.
+	modsdir := t.TempDir()
+	writeTestMod(t, filepath.Join(modsdir, "Lib"), map[string]string{"Lib.dll": "old"})
+	db := &installDB{Mods: map[string]*installRecord{}}
+	batch := newInstallBatch(modsdir)
+	stageTestMod(t, batch, "Lib", map[string]string{"Lib.dll": "new"})
+	stageTestMod(t, batch, "App", map[string]string{"App.dll": "new"})
+	staged := &stagedInstall{batch: batch, mods: []stagedMod{
+		{mod: modlinks.Manifest{Name: "Lib", Dependencies: []modlinks.Dependency{}}},
+		{mod: modlinks.Manifest{Name: "App", Dependencies: []modlinks.Dependency{{Name: "Lib"}}}},
+	}}
+	staged.commit(db, func(string) modOrigin { return originModlinks }, map[string]bool{"App": true}, nil)
+
+	// Yeeting App must not make autoremove consider Lib unneeded.
+	delete(db.Mods, "App")
+	if orphans := findOrphanedDependencies([]string{"Lib"}, nil, db, nil); len(orphans) != 0 {
+		t.Errorf("orphans = %q, want none", orphans)
+	}
+}
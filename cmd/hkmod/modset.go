@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+// A lockedMod pins a mod to one exact file, identified by its hash.
+type lockedMod struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+	// Origin is empty for mods from modlinks.
+	Origin       modOrigin             `json:"origin,omitempty"`
+	Dependencies []modlinks.Dependency `json:"dependencies,omitempty"`
+}
+
+func lockRecord(rec *installRecord) lockedMod {
+	lm := lockedMod{
+		Name:         rec.Name,
+		Version:      rec.Version,
+		URL:          rec.URL,
+		SHA256:       rec.SHA256,
+		Dependencies: rec.Dependencies,
+	}
+	if rec.Origin != originModlinks {
+		lm.Origin = rec.Origin
+	}
+	return lm
+}
+
+func lockManifest(m *modlinks.Manifest) (lockedMod, error) {
+	link, err := selectLink(m)
+	if err != nil {
+		return lockedMod{}, err
+	}
+	return lockedMod{
+		Name:         m.Name,
+		Version:      m.Version,
+		URL:          link.URL,
+		SHA256:       link.SHA256,
+		Dependencies: m.Dependencies,
+	}, nil
+}
+
+func (lm *lockedMod) manifest() modlinks.Manifest {
+	return modlinks.Manifest{
+		Name:         lm.Name,
+		Version:      lm.Version,
+		Link:         modlinks.Link{URL: lm.URL, SHA256: lm.SHA256},
+		Dependencies: lm.Dependencies,
+	}
+}
+
+func (lm *lockedMod) origin() modOrigin {
+	if lm.Origin == "" {
+		return originModlinks
+	}
+	return lm.Origin
+}
+
+// lockInstalledMods returns the set of enabled mods, pinned to their installed versions.
+// Mods that hkmod has no record of cannot be pinned, and are reported and skipped.
+func lockInstalledMods(modsdir string, db *installDB) ([]lockedMod, error) {
+	mods, err := installedMods(modsdir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(mods)
+	locks := make([]lockedMod, 0, len(mods))
+	for _, name := range mods {
+		rec := db.lookup(name)
+		if rec == nil {
+			fmt.Printf("skipping %s: not installed by hkmod\n", name)
+			continue
+		}
+		locks = append(locks, lockRecord(rec))
+	}
+	return locks, nil
+}
+
+// syncModSet makes the set of enabled mods match want exactly. Mods that are already installed
+// at the right version are kept, disabled ones are re-enabled when possible, and the rest are
+// installed. Enabled mods that are not in want are passed to removeExtra, except for those that
+// hkmod has no record of, which it couldn't put back later; those are left alone unless
+// removeUnmanaged is set.
+//
+// All of the installs are done as a single batch, before any other mod is enabled or removed,
+// so that if any of them fails, the Mods directory is left as it was.
+func syncModSet(installdir, cachedir string, want []lockedMod, db *installDB, removeUnmanaged bool, removeExtra func(name string) error) error {
+	modsdir := filepath.Join(installdir, "Mods")
+	enabled, err := installedMods(modsdir)
+	if err != nil {
+		return err
+	}
+	disabled, err := disabledMods(modsdir)
+	if err != nil {
+		return err
+	}
+	wantSet := make(map[string]bool, len(want))
+	for _, lm := range want {
+		wantSet[lm.Name] = true
+	}
+	var toEnable []string
+	var installs []modlinks.Manifest
+	origins := map[string]modOrigin{}
+	for _, lm := range want {
+		rec := db.lookup(lm.Name)
+		matches := rec != nil && strings.EqualFold(rec.SHA256, lm.SHA256)
+		switch {
+		case matches && containsString(enabled, lm.Name):
+		case matches && containsString(disabled, lm.Name):
+			toEnable = append(toEnable, lm.Name)
+		default:
+			installs = append(installs, lm.manifest())
+			origins[lm.Name] = lm.origin()
+		}
+	}
+
+	if len(installs) > 0 {
+		summary := newInstallSummary(os.Stdout)
+		staged := stageMods(installdir, cachedir, installs, defaultDownloadJobs, db, summary)
+		if len(summary.Failed) > 0 {
+			if staged != nil {
+				staged.rollback(summary)
+			}
+			return errors.New("some mods could not be installed")
+		}
+		staged.commit(db, func(name string) modOrigin { return origins[name] }, nil, summary)
+	}
+
+	var errs []error
+	for _, name := range toEnable {
+		if err := enableMod(modsdir, name); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Println("Enabled", name)
+	}
+	for _, name := range enabled {
+		if wantSet[name] {
+			continue
+		}
+		if db.lookup(name) == nil && !removeUnmanaged {
+			fmt.Printf("Keeping %s: not installed by hkmod\n", name)
+			continue
+		}
+		if err := removeExtra(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+func outdated(args []string) error {
+	flags := flag.NewFlagSet("outdated", flag.ExitOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	mods, err := installedMods(modsdir)
+	if err != nil {
+		return err
+	}
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	manifests, err := getModlinks()
+	if err != nil {
+		return err
+	}
+	updates := findOutdatedMods(manifests, mods, db)
+	if len(updates) == 0 {
+		fmt.Println("All installed mods are up to date.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Mod\tInstalled\tLatest\tDependencies")
+	for _, u := range updates {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", u.name, u.installedVersion, u.latestVersion, u.depsChange)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(updates) == 1 {
+		return fmt.Errorf("1 installed mod is outdated")
+	}
+	return fmt.Errorf("%d installed mods are outdated", len(updates))
+}
+
+type modUpdate struct {
+	name                            string
+	installedVersion, latestVersion string
+	depsChange                      string
+}
+
+// findOutdatedMods returns, sorted by name, the installed mods whose installed files do not match
+// the ones currently listed on modlinks. Mods that do not exist on modlinks are ignored, as there is
+// nothing to compare them to; mods that hkmod has no record of are always considered outdated.
+func findOutdatedMods(manifests []modlinks.Manifest, installed []string, db *installDB) []modUpdate {
+	manifestsByName := make(map[string]*modlinks.Manifest, len(manifests))
+	for i := range manifests {
+		manifestsByName[manifests[i].Name] = &manifests[i]
+	}
+	var updates []modUpdate
+	for _, name := range installed {
+		m, ok := manifestsByName[name]
+		if !ok {
+			continue
+		}
+		link, err := selectLink(m)
+		if err != nil {
+			continue
+		}
+		rec := db.lookup(name)
+		if isUpToDate(rec, link) {
+			continue
+		}
+		u := modUpdate{name: name, installedVersion: "unknown", latestVersion: m.Version, depsChange: "unknown"}
+		if rec != nil {
+			if rec.Version != "" {
+				u.installedVersion = rec.Version
+			}
+			if rec.Dependencies != nil {
+				u.depsChange = describeDepsChange(rec.Dependencies, m.Dependencies)
+			}
+		}
+		updates = append(updates, u)
+	}
+	sort.Slice(updates, func(i, j int) bool { return updates[i].name < updates[j].name })
+	return updates
+}
+
+// isUpToDate reports whether the installed mod described by rec, which may be nil, is the one
+// pointed to by link.
+func isUpToDate(rec *installRecord, link modlinks.Link) bool {
+	return rec != nil && strings.EqualFold(rec.SHA256, link.SHA256)
+}
+
+func describeDepsChange(oldDeps, newDeps []modlinks.Dependency) string {
+	var added, removed []string
+	for _, d := range newDeps {
+		if !containsDependency(oldDeps, d) {
+			added = append(added, "+"+d.String())
+		}
+	}
+	for _, d := range oldDeps {
+		if !containsDependency(newDeps, d) {
+			removed = append(removed, "-"+d.String())
+		}
+	}
+	if len(added) == 0 && len(removed) == 0 {
+		return "unchanged"
+	}
+	return "changed (" + strings.Join(append(added, removed...), ", ") + ")"
+}
+
+func containsDependency(list []modlinks.Dependency, x modlinks.Dependency) bool {
+	for _, y := range list {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, x string) bool {
+	for _, y := range list {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
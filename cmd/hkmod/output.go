@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+// writeJSON prints v to standard output in JSON format.
+func writeJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "\t")
+	return enc.Encode(v)
+}
+
+// messageOutput returns where a command should print its messages: standard error if it prints
+// JSON to standard output, so as to keep that valid, and standard output otherwise.
+func messageOutput(jsonOut bool) io.Writer {
+	if jsonOut {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// formatEscapes lets list formats contain tabs and newlines even when they can't easily be typed
+// in the shell.
+var formatEscapes = strings.NewReplacer(`\t`, "\t", `\n`, "\n", `\\`, `\`)
+
+// parseListFormat parses the template given to list -format.
+func parseListFormat(format string) (*template.Template, error) {
+	tmpl, err := template.New("format").Parse(expandFormatEscapes(format))
+	if err != nil {
+		return nil, fmt.Errorf("invalid format: %w", err)
+	}
+	return tmpl, nil
+}
+
+// expandFormatEscapes replaces formatEscapes in the text of a template, leaving its actions alone,
+// since string constants in them have escapes of their own.
+func expandFormatEscapes(format string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(format, "{{")
+		if start == -1 {
+			b.WriteString(formatEscapes.Replace(format))
+			return b.String()
+		}
+		end := start + 2 + actionLength(format[start+2:])
+		b.WriteString(formatEscapes.Replace(format[:start]))
+		b.WriteString(format[start:end])
+		format = format[end:]
+	}
+}
+
+// actionLength returns the length of the template action at the start of s, up to and including
+// its closing delimiter, or len(s) if it isn't closed; delimiters inside quotes or comments don't
+// count.
+func actionLength(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'', '`':
+			q := s[i]
+			for i++; i < len(s) && s[i] != q; i++ {
+				if s[i] == '\\' && q != '`' {
+					i++
+				}
+			}
+		case '/':
+			if strings.HasPrefix(s[i:], "/*") {
+				end := strings.Index(s[i+2:], "*/")
+				if end == -1 {
+					return len(s)
+				}
+				i += 2 + end + 1
+			}
+		case '}':
+			if strings.HasPrefix(s[i:], "}}") {
+				return i + 2
+			}
+		}
+	}
+	return len(s)
+}
+
+// A listEntry is the information about a mod shown by the list command.
+type listEntry struct {
+	Name string `json:"name"`
+	// OnModlinks is false for installed mods that aren't listed on modlinks, for which
+	// only Name and Installed are set.
+	OnModlinks   bool             `json:"onModlinks"`
+	Version      string           `json:"version,omitempty"`
+	Description  string           `json:"description,omitempty"`
+	Repository   string           `json:"repository,omitempty"`
+	Source       string           `json:"source,omitempty"`
+	AlsoIn       []string         `json:"alsoIn,omitempty"`
+	Link         *jsonLink        `json:"link,omitempty"`
+	OSLinks      *jsonOSLinks     `json:"osLinks,omitempty"`
+	Dependencies []jsonDependency `json:"dependencies"`
+	// Installed is nil if the mod is not installed, or if the installed mods are unknown.
+	Installed *installedState `json:"installed,omitempty"`
+}
+
+type jsonLink struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+type jsonOSLinks struct {
+	Windows jsonLink `json:"windows"`
+	Mac     jsonLink `json:"mac"`
+	Linux   jsonLink `json:"linux"`
+}
+
+type jsonDependency struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type installedState struct {
+	// Version and SHA256 are empty if the mod was not installed by hkmod.
+	Version      string `json:"version,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+	Enabled      bool   `json:"enabled"`
+	AsDependency bool   `json:"asDependency"`
+}
+
+func newListEntry(m *modlinks.Manifest, alsoIn []string) listEntry {
+	e := listEntry{
+		Name:         m.Name,
+		OnModlinks:   true,
+		Version:      m.Version,
+		Description:  m.Description,
+		Repository:   m.Repository,
+		Source:       m.Source,
+		AlsoIn:       alsoIn,
+		Dependencies: make([]jsonDependency, len(m.Dependencies)),
+	}
+	if m.Link.URL != "" {
+		e.Link = &jsonLink{URL: m.Link.URL, SHA256: m.Link.SHA256}
+	}
+	if ol := m.OSLinks; ol != nil {
+		e.OSLinks = &jsonOSLinks{
+			Windows: jsonLink{URL: ol.Windows.URL, SHA256: ol.Windows.SHA256},
+			Mac:     jsonLink{URL: ol.Mac.URL, SHA256: ol.Mac.SHA256},
+			Linux:   jsonLink{URL: ol.Linux.URL, SHA256: ol.Linux.SHA256},
+		}
+	}
+	for i, d := range m.Dependencies {
+		e.Dependencies[i] = jsonDependency{Name: d.Name, Version: d.Version}
+	}
+	return e
+}
+
+// A modOutcome is one entry in the JSON summary printed by the install and yeet commands.
+type modOutcome struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	// Reason explains why a mod was skipped or failed.
+	Reason string `json:"reason,omitempty"`
+}
+
+// An installSummary records what happened to each mod during an install, and prints messages
+// about it as it goes.
+//
+// A nil *installSummary is valid; its methods then only print messages, to standard output.
+type installSummary struct {
+	Installed []modOutcome `json:"installed"`
+	// Skipped lists requests that could not be resolved to any mod.
+	Skipped []modOutcome `json:"skipped"`
+	Failed  []modOutcome `json:"failed"`
+	// Error is set if the install stopped before trying to install any mods.
+	Error string `json:"error,omitempty"`
+
+	out io.Writer
+}
+
+func newInstallSummary(out io.Writer) *installSummary {
+	return &installSummary{Installed: []modOutcome{}, Skipped: []modOutcome{}, Failed: []modOutcome{}, out: out}
+}
+
+// output returns the writer to which messages about the install should be printed.
+func (s *installSummary) output() io.Writer {
+	if s == nil {
+		return os.Stdout
+	}
+	return s.out
+}
+
+func (s *installSummary) printf(format string, a ...any) {
+	fmt.Fprintf(s.output(), format, a...)
+}
+
+func (s *installSummary) skip(request string, err error) {
+	fmt.Fprintln(s.output(), err)
+	if s != nil {
+		s.Skipped = append(s.Skipped, modOutcome{Name: request, Reason: err.Error()})
+	}
+}
+
+func (s *installSummary) fail(name string, err error) {
+	s.printf("cannot install %s: %v\n", name, err)
+	if s != nil {
+		s.Failed = append(s.Failed, modOutcome{Name: name, Reason: err.Error()})
+	}
+}
+
+// rollBack records that a mod was not installed because another one in the same batch failed.
+func (s *installSummary) rollBack(name, failed string) {
+	if s != nil {
+		s.Failed = append(s.Failed, modOutcome{Name: name, Reason: "rolled back because " + failed + " failed"})
+	}
+}
+
+func (s *installSummary) install(name, version string) {
+	if s != nil {
+		s.Installed = append(s.Installed, modOutcome{Name: name, Version: version})
+	}
+}
+
+// A yeetSummary records what happened to each mod during a yeet.
+type yeetSummary struct {
+	Removed []modOutcome `json:"removed"`
+	// Skipped lists requests that did not match any installed mod.
+	Skipped []modOutcome `json:"skipped"`
+	Failed  []modOutcome `json:"failed"`
+	// Error is set if the yeet stopped before removing any mods.
+	Error string `json:"error,omitempty"`
+}
+
+func newYeetSummary() *yeetSummary {
+	return &yeetSummary{Removed: []modOutcome{}, Skipped: []modOutcome{}, Failed: []modOutcome{}}
+}
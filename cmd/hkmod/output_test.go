@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseListFormat(t *testing.T) {
+	entry := listEntry{Name: "Benchwarp", Version: "3.2.0.0"}
+	cases := []struct {
+		format string
+		want   string
+	}{
+		{`{{.Name}}\t{{.Version}}`, "Benchwarp\t3.2.0.0"},
+		{`{{.Name}}\n\\n`, "Benchwarp\n\\n"},
+		// Escapes inside actions are left for the template to interpret.
+		{`{{printf "%s\n" .Name}}`, "Benchwarp\n"},
+		{`{{printf "%s\\t%s" .Name .Version}}`, "Benchwarp\\t3.2.0.0"},
+		{"{{printf `%s\\t` .Name}}", "Benchwarp\\t"},
+		{`{{"}}\t"}}\t`, "}}\t\t"},
+		{`{{/* "\t" }} */}}\t{{.Name}}`, "\tBenchwarp"},
+		{`{{'}'}}`, "125"},
+	}
+	for _, c := range cases {
+		tmpl, err := parseListFormat(c.format)
+		if err != nil {
+			t.Errorf("parseListFormat(%q): %v", c.format, err)
+			continue
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, entry); err != nil {
+			t.Errorf("execute %q: %v", c.format, err)
+			continue
+		}
+		if got := b.String(); got != c.want {
+			t.Errorf("format %q = %q, want %q", c.format, got, c.want)
+		}
+	}
+}
+
+func TestParseListFormatErrors(t *testing.T) {
+	for _, format := range []string{`{{.Name`, `{{"unterminated}}`, `{{/* unterminated }}`} {
+		if _, err := parseListFormat(format); err == nil {
+			t.Errorf("parseListFormat(%q) succeeded, want error", format)
+		}
+	}
+}
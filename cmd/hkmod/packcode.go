@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+// packCodePrefix identifies pack codes and the version of their format.
+const packCodePrefix = "hk1:"
+
+// maxPackCodeSize is the largest that the decompressed contents of a pack code may be. It is far
+// more than any real set of mods needs, but stops a small code from decompressing into gigabytes.
+const maxPackCodeSize = 1 << 20
+
+// packHashLen is how many hex digits of a mod's hash are included in a pack code when its
+// version is not known; that is plenty to tell different releases of the same mod apart.
+const packHashLen = 12
+
+// A packEntry is a mod in a pack code. At most one of Version and SHA256Prefix is set.
+type packEntry struct {
+	Name         string
+	Version      string
+	SHA256Prefix string
+}
+
+func packCode(args []string) error {
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	mods, err := installedMods(modsdir)
+	if err != nil {
+		return err
+	}
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	sort.Strings(mods)
+	entries := make([]packEntry, len(mods))
+	for i, name := range mods {
+		entries[i].Name = name
+		if rec := db.lookup(name); rec != nil {
+			if rec.Version != "" {
+				entries[i].Version = rec.Version
+			} else if len(rec.SHA256) >= packHashLen {
+				entries[i].SHA256Prefix = strings.ToLower(rec.SHA256[:packHashLen])
+			}
+		}
+	}
+	code, err := encodePackCode(entries)
+	if err != nil {
+		return err
+	}
+	fmt.Println(code)
+	return nil
+}
+
+// encodePackCode encodes each entry into a line of the form name@version or name#hash, then
+// compresses the whole thing to make it shorter. Entries with neither are just the name, unless
+// that contains @ or #, in which case an empty version is added so that it decodes correctly.
+func encodePackCode(entries []packEntry) (string, error) {
+	var text strings.Builder
+	for i, e := range entries {
+		if i > 0 {
+			text.WriteByte('\n')
+		}
+		text.WriteString(e.Name)
+		switch {
+		case e.Version != "":
+			text.WriteString("@" + e.Version)
+		case e.SHA256Prefix != "":
+			text.WriteString("#" + e.SHA256Prefix)
+		case strings.ContainsAny(e.Name, "@#"):
+			text.WriteByte('@')
+		}
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(w, text.String()); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return packCodePrefix + base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decodePackCode(code string) ([]packEntry, error) {
+	wrap := func(err error) error { return fmt.Errorf("invalid pack code: %w", err) }
+	data, ok := strings.CutPrefix(strings.TrimSpace(code), packCodePrefix)
+	if !ok {
+		return nil, wrap(fmt.Errorf("does not start with %q", packCodePrefix))
+	}
+	compressed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return nil, wrap(err)
+	}
+	text, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(compressed)), maxPackCodeSize+1))
+	if err != nil {
+		return nil, wrap(err)
+	}
+	if len(text) > maxPackCodeSize {
+		return nil, wrap(fmt.Errorf("contents are larger than %d bytes", maxPackCodeSize))
+	}
+	var entries []packEntry
+	for _, line := range strings.Split(string(text), "\n") {
+		if line == "" {
+			continue
+		}
+		var e packEntry
+		if i := strings.LastIndexAny(line, "@#"); i != -1 {
+			if line[i] == '@' {
+				e.Version = line[i+1:]
+			} else {
+				e.SHA256Prefix = line[i+1:]
+			}
+			line = line[:i]
+		}
+		e.Name = line
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// resolvePackCode returns the names of the mods in a pack code that exist on modlinks, warning
+// about any whose modlinks versions differ from the ones the code was made with. Mods that don't
+// exist are recorded as skipped in summary.
+func resolvePackCode(manifests []modlinks.Manifest, code string, summary *installSummary) ([]string, error) {
+	entries, err := decodePackCode(code)
+	if err != nil {
+		return nil, err
+	}
+	manifestsByName := make(map[string]*modlinks.Manifest, len(manifests))
+	for i := range manifests {
+		manifestsByName[manifests[i].Name] = &manifests[i]
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		m, ok := manifestsByName[e.Name]
+		if !ok {
+			summary.skip(e.Name, fmt.Errorf("cannot install %s: not listed on modlinks", e.Name))
+			continue
+		}
+		switch {
+		case e.Version != "" && e.Version != m.Version:
+			summary.printf("warning: pack has %s version %s, but modlinks has version %s\n", e.Name, e.Version, m.Version)
+		case e.SHA256Prefix != "":
+			if link, err := selectLink(m); err == nil && !strings.HasPrefix(strings.ToLower(link.SHA256), e.SHA256Prefix) {
+				summary.printf("warning: pack has a different version of %s than the one on modlinks (version %s)\n", e.Name, m.Version)
+			}
+		}
+		names = append(names, e.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackCodeRoundTrip(t *testing.T) {
+	cases := [][]packEntry{
+		{{Name: "Benchwarp", Version: "3.2.0.0"}},
+		{
+			{Name: "ItemChanger", Version: "2.1.0.0"},
+			{Name: "Randomizer 4", Version: "4.1.0.0"},
+			{Name: "Transcendence", SHA256Prefix: "0123456789ab"},
+			{Name: "Unrecorded"},
+		},
+		// Names may contain the characters that separate them from versions and hashes.
+		{
+			{Name: "Mod@Home", Version: "1.0"},
+			{Name: "C# Tools", SHA256Prefix: "abcdef012345"},
+			{Name: "A@B#C"},
+			{Name: "Trailing@"},
+			{Name: "#"},
+		},
+	}
+	for _, entries := range cases {
+		code, err := encodePackCode(entries)
+		if err != nil {
+			t.Errorf("encodePackCode(%+v): %v", entries, err)
+			continue
+		}
+		if !strings.HasPrefix(code, packCodePrefix) {
+			t.Errorf("encodePackCode(%+v) = %q, want prefix %q", entries, code, packCodePrefix)
+		}
+		got, err := decodePackCode(code)
+		if err != nil {
+			t.Errorf("decodePackCode(%q): %v", code, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, entries) {
+			t.Errorf("round trip of %+v = %+v", entries, got)
+		}
+	}
+}
+
+func TestDecodePackCodeSurroundingSpace(t *testing.T) {
+	entries := []packEntry{{Name: "Benchwarp", Version: "3.2.0.0"}}
+	code, err := encodePackCode(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodePackCode(" " + code + "\n")
+	if err != nil || !reflect.DeepEqual(got, entries) {
+		t.Errorf("decodePackCode = %+v, %v, want %+v", got, err, entries)
+	}
+}
+
+// compressedPackCode makes a pack code out of text, without any checks on its contents.
+func compressedPackCode(t *testing.T, text string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return packCodePrefix + base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestDecodePackCodeErrors(t *testing.T) {
+	valid, err := encodePackCode([]packEntry{{Name: "Benchwarp"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := strings.TrimPrefix(valid, packCodePrefix)
+	cases := []struct {
+		desc string
+		code string
+	}{
+		{"no prefix", data},
+		{"wrong prefix", "hk2:" + data},
+		{"bad base64", packCodePrefix + "not*base64!"},
+		{"padded base64", packCodePrefix + base64.URLEncoding.EncodeToString([]byte("xx"))},
+		{"not compressed", packCodePrefix + base64.RawURLEncoding.EncodeToString([]byte("Benchwarp"))},
+		{"too large", compressedPackCode(t, strings.Repeat("a", maxPackCodeSize+1))},
+	}
+	for _, c := range cases {
+		if got, err := decodePackCode(c.code); err == nil {
+			t.Errorf("%s: decodePackCode(%.40q) = %+v, want error", c.desc, c.code, got)
+		}
+	}
+}
+
+func TestDecodePackCodeMaxSize(t *testing.T) {
+	name := strings.Repeat("a", maxPackCodeSize)
+	got, err := decodePackCode(compressedPackCode(t, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != name {
+		t.Errorf("decoded %d entries, want one named with %d a's", len(got), maxPackCodeSize)
+	}
+}
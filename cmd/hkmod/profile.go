@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+const profilesFileName = "profiles.json"
+
+type profileSet struct {
+	Active   string                 `json:"active,omitempty"`
+	Profiles map[string]*modProfile `json:"profiles"`
+}
+
+type modProfile struct {
+	Mods []lockedMod `json:"mods"`
+}
+
+func loadProfiles(configdir string) (*profileSet, error) {
+	ps := &profileSet{}
+	content, err := os.ReadFile(filepath.Join(configdir, profilesFileName))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("read profiles: %w", err)
+	default:
+		if err := json.Unmarshal(content, ps); err != nil {
+			return nil, fmt.Errorf("read profiles: %w", err)
+		}
+	}
+	if ps.Profiles == nil {
+		ps.Profiles = map[string]*modProfile{}
+	}
+	return ps, nil
+}
+
+func (ps *profileSet) save(configdir string) error {
+	wrap := func(err error) error { return fmt.Errorf("write profiles: %w", err) }
+	content, err := json.MarshalIndent(ps, "", "\t")
+	if err != nil {
+		return wrap(err)
+	}
+	if err := writeFileAtomic(filepath.Join(configdir, profilesFileName), content); err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+func profile(args []string) error {
+	const usage = "usage: profile create|switch|list|delete [name] [modnames ...]"
+	if len(args) < 1 {
+		return fmt.Errorf(usage)
+	}
+	configdir, err := configDir()
+	if err != nil {
+		return err
+	}
+	ps, err := loadProfiles(configdir)
+	if err != nil {
+		return err
+	}
+	subcmd := args[0]
+	if subcmd == "list" {
+		profileList(ps)
+		return nil
+	}
+	if len(args) < 2 {
+		return fmt.Errorf(usage)
+	}
+	name := args[1]
+	switch subcmd {
+	case "create":
+		err = profileCreate(ps, name, args[2:])
+	case "switch":
+		err = profileSwitch(ps, name)
+	case "delete":
+		if _, ok := ps.Profiles[name]; !ok {
+			return fmt.Errorf("profile %q does not exist", name)
+		}
+		delete(ps.Profiles, name)
+		if ps.Active == name {
+			ps.Active = ""
+		}
+	default:
+		return fmt.Errorf("unknown profile subcommand: %q", subcmd)
+	}
+	if err != nil {
+		return err
+	}
+	return ps.save(configdir)
+}
+
+func profileList(ps *profileSet) {
+	names := make([]string, 0, len(ps.Profiles))
+	for name := range ps.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		marker := " "
+		if name == ps.Active {
+			marker = "*"
+		}
+		fmt.Printf("%s %s (%d mods)\n", marker, name, len(ps.Profiles[name].Mods))
+	}
+}
+
+// profileCreate creates a profile containing the named mods from modlinks, along with their
+// dependencies, or if no mods are given, containing the currently enabled mods.
+func profileCreate(ps *profileSet, name string, modnames []string) error {
+	if _, ok := ps.Profiles[name]; ok {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+	var mods []lockedMod
+	if len(modnames) == 0 {
+		installdir, err := installDir()
+		if err != nil {
+			return err
+		}
+		modsdir := filepath.Join(installdir, "Mods")
+		db, err := loadInstallDB(modsdir)
+		if err != nil {
+			return err
+		}
+		mods, err = lockInstalledMods(modsdir, db)
+		if err != nil {
+			return err
+		}
+		// The enabled mods are exactly the ones in this profile, apart from any that hkmod didn't
+		// install, which switching profiles leaves alone.
+		ps.Active = name
+	} else {
+		manifests, err := getModlinks()
+		if err != nil {
+			return err
+		}
+		resolvedMods := make([]string, 0, len(modnames))
+		for _, requestedName := range modnames {
+			mod, err := resolveMod(manifests, requestedName)
+			if err != nil {
+				return err
+			}
+			resolvedMods = append(resolvedMods, mod)
+		}
+		closure, err := modlinks.TransitiveClosure(manifests, resolvedMods)
+		if err != nil {
+			return err
+		}
+		sort.Slice(closure, func(i, j int) bool { return closure[i].Name < closure[j].Name })
+		for i := range closure {
+			lm, err := lockManifest(&closure[i])
+			if err != nil {
+				return fmt.Errorf("cannot add %s to profile: %w", closure[i].Name, err)
+			}
+			mods = append(mods, lm)
+		}
+	}
+	ps.Profiles[name] = &modProfile{Mods: mods}
+	fmt.Printf("Created profile %s with %d mods\n", name, len(mods))
+	return nil
+}
+
+// profileSwitch makes the enabled mods match the named profile. Mods not in the profile are
+// disabled rather than removed, so that switching back is quick and does not need to download
+// anything. If any mod in the profile can't be installed, nothing is changed and the profile
+// does not become active.
+func profileSwitch(ps *profileSet, name string) error {
+	p, ok := ps.Profiles[name]
+	if !ok {
+		return fmt.Errorf("profile %q does not exist", name)
+	}
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	cachedir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	err = syncModSet(installdir, cachedir, p.Mods, db, false, func(mod string) error {
+		if _, err := os.Stat(filepath.Join(modsdir, disabledDirName, mod)); err == nil {
+			// The disabled copy is another version, which some other profile may need; this
+			// one is recorded, so it can be installed again from the cache.
+			if err := removePreviousVersion(mod, installdir); err != nil {
+				return err
+			}
+			delete(db.Mods, mod)
+			fmt.Println("Yeeted", mod, "(another version is already disabled)")
+			return nil
+		}
+		if err := disableMod(modsdir, mod); err != nil {
+			return err
+		}
+		fmt.Println("Disabled", mod)
+		return nil
+	})
+	if serr := db.save(modsdir); serr != nil {
+		return serr
+	}
+	if err != nil {
+		return fmt.Errorf("cannot switch to profile %s: %w", name, err)
+	}
+	ps.Active = name
+	fmt.Println("Switched to profile", name)
+	return nil
+}
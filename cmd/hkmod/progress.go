@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	ansiEraseLine        = "\x1b[G\x1b[K"
+	progressUpdatePeriod = time.Second
+)
+
+// A progressView displays the combined progress of any number of simultaneous downloads on a
+// single line of the terminal. Other output should go through its println method, so that it does
+// not get mixed up with the progress line.
+//
+// A nil *progressView is valid, and displays nothing.
+type progressView struct {
+	out     io.Writer
+	display bool
+
+	mu         sync.Mutex
+	downloads  []*downloadProgress
+	lastUpdate time.Time
+}
+
+type downloadProgress struct {
+	view    *progressView
+	written dataSize
+	// total is -1 if the size of the download is not known.
+	total dataSize
+	done  bool
+}
+
+func newProgressView(out io.Writer) *progressView {
+	f, ok := out.(*os.File)
+	return &progressView{out: out, display: ok && isatty(f)}
+}
+
+func (p *progressView) println(a ...any) {
+	if p == nil {
+		fmt.Println(a...)
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.display {
+		fmt.Fprint(p.out, ansiEraseLine)
+	}
+	fmt.Fprintln(p.out, a...)
+	p.draw()
+}
+
+// start adds a new download of the given size, which may be -1 if it is not known.
+func (p *progressView) start(size int64) *downloadProgress {
+	d := &downloadProgress{view: p, total: dataSize(size)}
+	if p != nil {
+		p.mu.Lock()
+		p.downloads = append(p.downloads, d)
+		p.mu.Unlock()
+	}
+	return d
+}
+
+// finish erases the progress line; it should be called once all downloads are done.
+func (p *progressView) finish() {
+	if p != nil && p.display {
+		fmt.Fprint(p.out, ansiEraseLine)
+	}
+}
+
+// draw must be called with p.mu held.
+func (p *progressView) draw() {
+	if !p.display {
+		return
+	}
+	var written, total dataSize
+	active := 0
+	sizeKnown := true
+	for _, d := range p.downloads {
+		if d.done {
+			continue
+		}
+		active++
+		written += d.written
+		if d.total < 0 {
+			sizeKnown = false
+		} else {
+			total += d.total
+		}
+	}
+	if active == 0 {
+		return
+	}
+	totalText := "???"
+	if sizeKnown {
+		totalText = total.String()
+	}
+	files := "files"
+	if active == 1 {
+		files = "file"
+	}
+	fmt.Fprintf(p.out, ansiEraseLine+"downloading %d %s: %s of %s", active, files, written, totalText)
+}
+
+func (d *downloadProgress) Write(b []byte) (int, error) {
+	p := d.view
+	if p == nil {
+		return len(b), nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d.written += dataSize(len(b))
+	if now := time.Now(); now.Sub(p.lastUpdate) > progressUpdatePeriod {
+		p.lastUpdate = now
+		p.draw()
+	}
+	return len(b), nil
+}
+
+func (d *downloadProgress) finish() {
+	if p := d.view; p != nil {
+		p.mu.Lock()
+		d.done = true
+		p.mu.Unlock()
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+const sourcesFileName = "sources.json"
+
+// officialSourceName is the name of the official modlinks file, which is always a source, at
+// priority 0. Its location can be changed with the MODLINKSURL environment variable.
+const officialSourceName = "official"
+
+// A modlinksSource is a modlinks file from which mods can be installed.
+type modlinksSource struct {
+	Name string `json:"name"`
+	// Location is either a URL or a local file path.
+	Location string `json:"location"`
+	// Sources with higher priority take precedence when several define the same mod.
+	Priority int `json:"priority"`
+}
+
+func loadSources(configdir string) ([]modlinksSource, error) {
+	var sources []modlinksSource
+	content, err := os.ReadFile(filepath.Join(configdir, sourcesFileName))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("read sources: %w", err)
+	default:
+		if err := json.Unmarshal(content, &sources); err != nil {
+			return nil, fmt.Errorf("read sources: %w", err)
+		}
+	}
+	return sources, nil
+}
+
+func saveSources(configdir string, sources []modlinksSource) error {
+	wrap := func(err error) error { return fmt.Errorf("write sources: %w", err) }
+	content, err := json.MarshalIndent(sources, "", "\t")
+	if err != nil {
+		return wrap(err)
+	}
+	if err := writeFileAtomic(filepath.Join(configdir, sourcesFileName), content); err != nil {
+		return wrap(err)
+	}
+	return nil
+}
+
+// allSources returns the official source and all configured ones, from highest to lowest
+// priority. Sources with the same priority are kept in the order they were added, with the
+// official one first.
+func allSources() ([]modlinksSource, error) {
+	configdir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	configured, err := loadSources(configdir)
+	if err != nil {
+		return nil, err
+	}
+	sources := append([]modlinksSource{{Name: officialSourceName, Location: modlinksURL()}}, configured...)
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].Priority > sources[j].Priority })
+	return sources, nil
+}
+
+// getCatalog fetches every modlinks source, through the cache, and merges them into one list
+// of mods. A source that cannot be fetched is skipped with a warning, unless it is the only one.
+func getCatalog() ([]modlinks.Manifest, []modlinks.Conflict, error) {
+	mc, err := modlinksCache()
+	if err != nil {
+		return nil, nil, err
+	}
+	sources, err := allSources()
+	if err != nil {
+		return nil, nil, err
+	}
+	catalogs := make([][]modlinks.Manifest, 0, len(sources))
+	for _, src := range sources {
+		manifests, err := mc.Get(src.Location)
+		if err != nil {
+			if len(sources) == 1 {
+				return nil, nil, err
+			}
+			fmt.Fprintf(os.Stderr, "warning: source %s: %v\n", src.Name, err)
+			continue
+		}
+		for i := range manifests {
+			manifests[i].Source = src.Name
+		}
+		catalogs = append(catalogs, manifests)
+	}
+	if len(catalogs) == 0 {
+		return nil, nil, fmt.Errorf("no modlinks source is available")
+	}
+	manifests, conflicts := modlinks.MergeSources(catalogs)
+	recordHistory(manifests)
+	return manifests, conflicts, nil
+}
+
+func sources(args []string) error {
+	const usage = "usage: sources list|add|remove [-priority n] [name] [location]"
+	if len(args) < 1 {
+		return fmt.Errorf(usage)
+	}
+	configdir, err := configDir()
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "list":
+		return sourcesList()
+	case "add":
+		return sourcesAdd(configdir, args[1:])
+	case "remove":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: sources remove name")
+		}
+		return sourcesRemove(configdir, args[1])
+	default:
+		return fmt.Errorf("unknown sources subcommand: %q", args[0])
+	}
+}
+
+func sourcesList() error {
+	sources, err := allSources()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "Priority\tName\tLocation")
+	for _, src := range sources {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", src.Priority, src.Name, src.Location)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(sources) == 1 {
+		return nil
+	}
+	_, conflicts, err := getCatalog()
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 {
+		fmt.Println()
+		fmt.Println("Mods defined by more than one source:")
+		for _, c := range conflicts {
+			fmt.Printf("\t%s: using %s (also in %s)\n", c.Name, c.Sources[0], strings.Join(c.Sources[1:], ", "))
+		}
+	}
+	return nil
+}
+
+func sourcesAdd(configdir string, args []string) error {
+	flags := flag.NewFlagSet("sources add", flag.ExitOnError)
+	var priority int
+	flags.IntVar(&priority, "priority", 0, "Give the source priority `n`; the official modlinks has priority 0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: sources add [-priority n] name location")
+	}
+	name, location := flags.Arg(0), flags.Arg(1)
+	if name == officialSourceName {
+		return fmt.Errorf("the %s source cannot be redefined; set %s to change its location", officialSourceName, modlinksURLEnvVar)
+	}
+	if !modlinks.IsFileURL(location) && !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		// Relative paths would otherwise depend on where hkmod is run from.
+		abs, err := filepath.Abs(location)
+		if err != nil {
+			return err
+		}
+		location = abs
+	}
+	sources, err := loadSources(configdir)
+	if err != nil {
+		return err
+	}
+	for _, src := range sources {
+		if src.Name == name {
+			return fmt.Errorf("source %s already exists", name)
+		}
+	}
+	sources = append(sources, modlinksSource{Name: name, Location: location, Priority: priority})
+	if err := saveSources(configdir, sources); err != nil {
+		return err
+	}
+	fmt.Printf("Added source %s with priority %d\n", name, priority)
+	return nil
+}
+
+func sourcesRemove(configdir, name string) error {
+	sources, err := loadSources(configdir)
+	if err != nil {
+		return err
+	}
+	for i, src := range sources {
+		if src.Name == name {
+			if err := saveSources(configdir, append(sources[:i], sources[i+1:]...)); err != nil {
+				return err
+			}
+			fmt.Println("Removed source", name)
+			return nil
+		}
+	}
+	return fmt.Errorf("source %s does not exist", name)
+}
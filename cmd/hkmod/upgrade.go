@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/dpinela/colophon/internal/modlinks"
+)
+
+func upgrade(args []string) error {
+	installdir, err := installDir()
+	if err != nil {
+		return err
+	}
+	cachedir, err := cacheDir()
+	if err != nil {
+		return err
+	}
+	modsdir := filepath.Join(installdir, "Mods")
+	installed, err := installedMods(modsdir)
+	if err != nil {
+		return err
+	}
+	db, err := loadInstallDB(modsdir)
+	if err != nil {
+		return err
+	}
+	manifests, err := getModlinks()
+	if err != nil {
+		return err
+	}
+	manifestsByName := make(map[string]*modlinks.Manifest, len(manifests))
+	for i := range manifests {
+		manifestsByName[manifests[i].Name] = &manifests[i]
+	}
+
+	var targets []string
+	if len(args) == 0 {
+		for _, name := range installed {
+			if _, ok := manifestsByName[name]; ok {
+				targets = append(targets, name)
+			}
+		}
+	} else {
+		for _, arg := range args {
+			name, err := resolveModName(installed, arg)
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if _, ok := manifestsByName[name]; !ok {
+				fmt.Printf("cannot upgrade %s: not listed on modlinks\n", name)
+				continue
+			}
+			targets = append(targets, name)
+		}
+		if len(targets) == 0 {
+			return nil
+		}
+	}
+
+	closure, err := modlinks.TransitiveClosure(manifests, targets)
+	if err != nil {
+		return err
+	}
+	var upgrades []modlinks.Manifest
+	for _, mod := range closure {
+		link, err := selectLink(&mod)
+		if err == nil && containsString(installed, mod.Name) && isUpToDate(db.lookup(mod.Name), link) {
+			continue
+		}
+		upgrades = append(upgrades, mod)
+	}
+	if len(upgrades) == 0 {
+		fmt.Println("All mods are up to date.")
+		return nil
+	}
+	// Mods that hkmod already knows about keep their status, and newly required dependencies are
+	// recorded as such; only mods installed by other tools count as requested.
+	installMods(installdir, cachedir, upgrades, originModlinks, map[string]bool{}, defaultDownloadJobs, db, nil)
+	return db.save(modsdir)
+}
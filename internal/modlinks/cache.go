@@ -0,0 +1,140 @@
+package modlinks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// A Cache fetches modlinks files, keeping a copy of each one so that it can be revalidated with
+// a conditional request the next time, and used in place of the original when the network is
+// unavailable.
+type Cache struct {
+	Dir string
+	// If Offline is true, only cached copies are used.
+	Offline bool
+	// Warn, if not nil, is called when a cached copy is used because the original could not
+	// be fetched.
+	Warn func(error)
+}
+
+type cacheMetadata struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+}
+
+// Get returns the mods listed in the modlinks file at modlinksURL, which may also be a local path
+// or a file:// URL.
+func (c *Cache) Get(modlinksURL string) ([]Manifest, error) {
+	return getModLinks(c.fetch, modlinksURL)
+}
+
+// GetAPI returns the release of the Modding API described by the apilinks file at apiLinksURL.
+func (c *Cache) GetAPI(apiLinksURL string) (APIManifest, error) {
+	return getAPI(c.fetch, apiLinksURL)
+}
+
+var errOffline = errors.New("no cached copy available in offline mode")
+
+func (c *Cache) fetch(url string) ([]byte, error) {
+	key := sha256.Sum256([]byte(url))
+	base := filepath.Join(c.Dir, hex.EncodeToString(key[:8]))
+	dataFile, metaFile := base+".xml", base+".json"
+
+	var meta cacheMetadata
+	cached, err := os.ReadFile(dataFile)
+	if err == nil {
+		if metaText, err := os.ReadFile(metaFile); err == nil {
+			// Without valid metadata, we just can't make a conditional request.
+			_ = json.Unmarshal(metaText, &meta)
+		}
+	} else {
+		cached = nil
+	}
+	if c.Offline {
+		if cached == nil {
+			return nil, errOffline
+		}
+		return cached, nil
+	}
+	fallback := func(err error) ([]byte, error) {
+		if cached == nil {
+			return nil, err
+		}
+		if c.Warn != nil {
+			c.Warn(fmt.Errorf("%s: %w; using copy cached at %s", url, err, meta.FetchedAt.Local().Format(time.DateTime)))
+		}
+		return cached, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && meta.URL == url {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fallback(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached, nil
+	}
+	if !isHTTPOK(resp.StatusCode) {
+		return fallback(fmt.Errorf("response status was %d", resp.StatusCode))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fallback(err)
+	}
+	meta = cacheMetadata{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now().UTC(),
+	}
+	if err := c.store(dataFile, metaFile, data, meta); err != nil && c.Warn != nil {
+		c.Warn(fmt.Errorf("cache %s: %w", url, err))
+	}
+	return data, nil
+}
+
+func (c *Cache) store(dataFile, metaFile string, data []byte, meta cacheMetadata) error {
+	metaText, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.Dir, 0750); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(dataFile, data); err != nil {
+		return err
+	}
+	return writeFileAtomic(metaFile, metaText)
+}
+
+// writeFileAtomic writes content to dest via a temporary file, so that an interrupted write never
+// leaves a truncated copy behind.
+func writeFileAtomic(dest string, content []byte) error {
+	tmp := dest + ".tmp"
+	if err := os.WriteFile(tmp, content, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
@@ -0,0 +1,58 @@
+package modlinks
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCacheFetch(t *testing.T) {
+	const content, etag = "<ModLinks/>", `"v1"`
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	c := &Cache{Dir: t.TempDir()}
+	for i := 0; i < 2; i++ {
+		data, err := c.fetch(srv.URL)
+		if err != nil || string(data) != content {
+			t.Fatalf("fetch #%d = %q, %v, want %q", i+1, data, err, content)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2", requests)
+	}
+	files, err := os.ReadDir(c.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("cache contains %d files, want data and metadata", len(files))
+	}
+	for _, f := range files {
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			t.Errorf("temporary file %s left in cache", f.Name())
+		}
+	}
+
+	srv.Close()
+	offline := &Cache{Dir: c.Dir, Offline: true}
+	if data, err := offline.fetch(srv.URL); err != nil || string(data) != content {
+		t.Errorf("offline fetch = %q, %v, want %q", data, err, content)
+	}
+	empty := &Cache{Dir: filepath.Join(c.Dir, "empty"), Offline: true}
+	if data, err := empty.fetch(srv.URL); err == nil {
+		t.Errorf("offline fetch with empty cache = %q, want error", data)
+	}
+}
@@ -2,8 +2,12 @@ package modlinks
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -16,9 +20,12 @@ type Manifest struct {
 	Description  string
 	Version      string
 	Link         Link
-	OSLinks      *OSLinkSet `xml:"Links,omitempty"`
-	Dependencies []string   `xml:"Dependencies>Dependency"`
+	OSLinks      *OSLinkSet   `xml:"Links,omitempty"`
+	Dependencies []Dependency `xml:"Dependencies>Dependency"`
 	Repository   string
+	// Source is the name of the modlinks source the manifest came from, when several are
+	// combined with MergeSources.
+	Source string `xml:"-"`
 }
 
 type OSLinkSet struct {
@@ -30,34 +37,114 @@ type Link struct {
 	URL    string `xml:",chardata"`
 }
 
-func Get(modlinksURL string) ([]Manifest, error) {
-	wrap := func(err error) error { return fmt.Errorf("get modlinks: %w", err) }
-	resp, err := http.Get(modlinksURL)
-	if err != nil {
-		return nil, wrap(err)
-	}
-	defer resp.Body.Close()
-	if !(resp.StatusCode >= 200 && resp.StatusCode < 300) {
-		return nil, fmt.Errorf("get modlinks: response status was %d", resp.StatusCode)
-	}
+func getModLinks(fetch fetchFunc, modlinksURL string) ([]Manifest, error) {
 	var links modLinks
-	if err := xml.NewDecoder(resp.Body).Decode(&links); err != nil {
-		return nil, wrap(err)
+	if err := getXML(fetch, modlinksURL, &links); err != nil {
+		return nil, fmt.Errorf("get modlinks: %w", err)
 	}
 	// The Link and Repository fields have some extra indentation inside them; discard it.
 	for i := range links.Manifests {
 		m := &links.Manifests[i]
 		m.Link.URL = strings.TrimSpace(m.Link.URL)
 		m.Repository = strings.TrimSpace(m.Repository)
+		for j := range m.Dependencies {
+			m.Dependencies[j].Name = strings.TrimSpace(m.Dependencies[j].Name)
+		}
 		if ol := m.OSLinks; ol != nil {
-			ol.Windows.URL = strings.TrimSpace(ol.Windows.URL)
-			ol.Linux.URL = strings.TrimSpace(ol.Linux.URL)
-			ol.Mac.URL = strings.TrimSpace(ol.Mac.URL)
+			ol.trimSpace()
 		}
 	}
 	return links.Manifests, nil
 }
 
+type apiLinks struct {
+	Manifest APIManifest
+}
+
+// An APIManifest describes a release of the Modding API.
+type APIManifest struct {
+	Version string
+	Links   OSLinkSet
+	// Files lists the files that the API installs into the game's Managed directory.
+	Files []string `xml:"Files>File"`
+}
+
+func getAPI(fetch fetchFunc, apiLinksURL string) (APIManifest, error) {
+	var links apiLinks
+	if err := getXML(fetch, apiLinksURL, &links); err != nil {
+		return APIManifest{}, fmt.Errorf("get apilinks: %w", err)
+	}
+	m := &links.Manifest
+	m.Version = strings.TrimSpace(m.Version)
+	m.Links.trimSpace()
+	for i, f := range m.Files {
+		m.Files[i] = strings.TrimSpace(f)
+	}
+	return *m, nil
+}
+
+type fetchFunc func(url string) ([]byte, error)
+
+func isHTTPOK(code int) bool { return code >= 200 && code < 300 }
+
+// isRemote reports whether a modlinks location is an HTTP URL, as opposed to a local file path
+// or file:// URL.
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// IsFileURL reports whether location is a file:// URL.
+func IsFileURL(location string) bool {
+	return strings.HasPrefix(location, "file://")
+}
+
+// FileURLPath returns the local file path that a file:// URL refers to.
+func FileURLPath(fileURL string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("%s is not a file URL", fileURL)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("%s refers to a file on another host", fileURL)
+	}
+	p := filepath.FromSlash(u.Path)
+	// On Windows, file:///C:/Mods/ModLinks.xml has a path of /C:/Mods/ModLinks.xml.
+	if len(p) > 1 && filepath.VolumeName(p[1:]) != "" {
+		p = p[1:]
+	}
+	return p, nil
+}
+
+func getXML(fetch fetchFunc, url string, v any) error {
+	var data []byte
+	var err error
+	switch {
+	case IsFileURL(url):
+		var localPath string
+		localPath, err = FileURLPath(url)
+		if err == nil {
+			data, err = os.ReadFile(localPath)
+		}
+	case isRemote(url):
+		data, err = fetch(url)
+	default:
+		data, err = os.ReadFile(url)
+	}
+	if err != nil {
+		return err
+	}
+	return xml.Unmarshal(data, v)
+}
+
+func (ol *OSLinkSet) trimSpace() {
+	ol.Windows.URL = strings.TrimSpace(ol.Windows.URL)
+	ol.Linux.URL = strings.TrimSpace(ol.Linux.URL)
+	ol.Mac.URL = strings.TrimSpace(ol.Mac.URL)
+}
+
 func ParseManifest(text []byte) (Manifest, error) {
 	var m Manifest
 	err := xml.Unmarshal(text, &m)
@@ -86,48 +173,146 @@ func (m *Manifest) Merge(patch Manifest) {
 	}
 }
 
-type missingModsError []string
+// A Conflict records that several modlinks sources define a mod with the same name.
+type Conflict struct {
+	Name string
+	// Sources lists the sources defining the mod, starting with the one whose definition is used.
+	Sources []string
+}
+
+// MergeSources combines the mods from several modlinks sources, given in decreasing order of
+// priority, into one list. Each manifest's Source must already be set. Where more than one
+// source defines a mod, the definition from the first of them is used, and the others are
+// reported as a conflict.
+func MergeSources(catalogs [][]Manifest) ([]Manifest, []Conflict) {
+	var merged []Manifest
+	definedBy := map[string][]string{}
+	for _, catalog := range catalogs {
+		for _, m := range catalog {
+			sources, ok := definedBy[m.Name]
+			if !ok {
+				merged = append(merged, m)
+			}
+			definedBy[m.Name] = append(sources, m.Source)
+		}
+	}
+	var conflicts []Conflict
+	for name, sources := range definedBy {
+		if len(sources) > 1 {
+			conflicts = append(conflicts, Conflict{Name: name, Sources: sources})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Name < conflicts[j].Name })
+	return merged, conflicts
+}
+
+// A missingDependency is a mod that was required but does not exist.
+type missingDependency struct {
+	name string
+	// requiredBy lists the mods that depend on the missing one. It is empty if the mod was
+	// requested directly.
+	requiredBy []string
+}
+
+type missingModsError []*missingDependency
 
 func (err missingModsError) Error() string {
-	return fmt.Sprintf("required mods do not exist: %s", strings.Join(err, ","))
+	descs := make([]string, len(err))
+	for i, m := range err {
+		descs[i] = m.name
+		if len(m.requiredBy) > 0 {
+			descs[i] += " (required by " + strings.Join(m.requiredBy, ", ") + ")"
+		}
+	}
+	return fmt.Sprintf("required mods do not exist: %s", strings.Join(descs, ", "))
 }
 
+// A cycleError lists mods that depend on each other in a cycle, starting and ending with the
+// same one.
+type cycleError []string
+
+func (err cycleError) Error() string {
+	return "dependency cycle: " + strings.Join(err, " -> ")
+}
+
+// TransitiveClosure returns the named mods along with everything they depend on, directly or
+// indirectly, ordered so that every mod comes after its dependencies. If any dependencies are
+// missing or form a cycle, it returns an error describing them, along with as much of the
+// closure as could be computed.
 func TransitiveClosure(allModlinks []Manifest, mods []string) ([]Manifest, error) {
-	modsByName := make(map[string]*Manifest, len(allModlinks))
+	c := closure{
+		modsByName: make(map[string]*Manifest, len(allModlinks)),
+		state:      map[string]visitState{},
+		missing:    map[string]*missingDependency{},
+	}
 	for i := range allModlinks {
-		modsByName[allModlinks[i].Name] = &allModlinks[i]
+		c.modsByName[allModlinks[i].Name] = &allModlinks[i]
 	}
-	resultSet := map[string]*Manifest{}
-	missingModSet := map[string]bool{}
 	for _, name := range mods {
-		transitiveClosure(modsByName, resultSet, missingModSet, name)
+		c.visit(name, "")
 	}
-	result := make([]Manifest, 0, len(resultSet))
-	for _, mod := range resultSet {
-		result = append(result, *mod)
+	var errs []error
+	if len(c.missingOrder) > 0 {
+		errs = append(errs, c.missingOrder)
 	}
-	missing := make(missingModsError, 0, len(missingModSet))
-	for name := range missingModSet {
-		missing = append(missing, name)
+	for _, cycle := range c.cycles {
+		errs = append(errs, cycle)
 	}
-	var err error
-	if len(missing) > 0 {
-		err = missing
-	}
-	return result, err
+	return c.result, errors.Join(errs...)
 }
 
-func transitiveClosure(modsByName, resultSet map[string]*Manifest, missingMods map[string]bool, modName string) {
-	if _, ok := resultSet[modName]; ok {
+type visitState int
+
+const (
+	unvisited visitState = iota
+	visiting
+	visited
+)
+
+type closure struct {
+	modsByName   map[string]*Manifest
+	state        map[string]visitState
+	stack        []string
+	result       []Manifest
+	missing      map[string]*missingDependency
+	missingOrder missingModsError
+	cycles       []cycleError
+}
+
+// visit adds a mod to the closure after all of its dependencies; requiredBy is the mod that
+// depends on it, or the empty string if it was requested directly.
+func (c *closure) visit(name, requiredBy string) {
+	switch c.state[name] {
+	case visited:
+		return
+	case visiting:
+		for i, n := range c.stack {
+			if n == name {
+				c.cycles = append(c.cycles, append(append(cycleError{}, c.stack[i:]...), name))
+				break
+			}
+		}
 		return
 	}
-	mod, ok := modsByName[modName]
+	mod, ok := c.modsByName[name]
 	if !ok {
-		missingMods[modName] = true
+		m := c.missing[name]
+		if m == nil {
+			m = &missingDependency{name: name}
+			c.missing[name] = m
+			c.missingOrder = append(c.missingOrder, m)
+		}
+		if requiredBy != "" {
+			m.requiredBy = append(m.requiredBy, requiredBy)
+		}
 		return
 	}
-	resultSet[modName] = mod
+	c.state[name] = visiting
+	c.stack = append(c.stack, name)
 	for _, dep := range mod.Dependencies {
-		transitiveClosure(modsByName, resultSet, missingMods, dep)
+		c.visit(dep.Name, name)
 	}
+	c.stack = c.stack[:len(c.stack)-1]
+	c.state[name] = visited
+	c.result = append(c.result, *mod)
 }
@@ -0,0 +1,167 @@
+package modlinks
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testCatalog builds a modlinks catalog from a map of each mod's name to its dependencies.
+func testCatalog(deps map[string][]string) []Manifest {
+	var manifests []Manifest
+	for name, ds := range deps {
+		m := Manifest{Name: name, Dependencies: []Dependency{}}
+		for _, d := range ds {
+			m.Dependencies = append(m.Dependencies, Dependency{Name: d})
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests
+}
+
+func names(manifests []Manifest) []string {
+	ns := make([]string, len(manifests))
+	for i, m := range manifests {
+		ns[i] = m.Name
+	}
+	return ns
+}
+
+func TestTransitiveClosureOrder(t *testing.T) {
+	catalog := testCatalog(map[string][]string{
+		"Randomizer 4": {"ItemChanger", "MenuChanger"},
+		"RandoMapMod":  {"ItemChanger", "Randomizer 4", "Benchwarp"},
+		"ItemChanger":  nil,
+		"MenuChanger":  nil,
+		"Benchwarp":    nil,
+		"Unrelated":    {"Benchwarp"},
+	})
+	cases := []struct {
+		request []string
+		want    []string
+	}{
+		{[]string{"Benchwarp"}, []string{"Benchwarp"}},
+		{[]string{"Randomizer 4"}, []string{"ItemChanger", "MenuChanger", "Randomizer 4"}},
+		{[]string{"RandoMapMod"}, []string{"ItemChanger", "MenuChanger", "Randomizer 4", "Benchwarp", "RandoMapMod"}},
+		// Mods that are requested and also needed by other requested mods are only included once.
+		{[]string{"ItemChanger", "Randomizer 4", "ItemChanger"}, []string{"ItemChanger", "MenuChanger", "Randomizer 4"}},
+		{nil, []string{}},
+	}
+	for _, c := range cases {
+		closure, err := TransitiveClosure(catalog, c.request)
+		if err != nil {
+			t.Errorf("TransitiveClosure(%q): %v", c.request, err)
+			continue
+		}
+		if got := names(closure); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("TransitiveClosure(%q) = %q, want %q", c.request, got, c.want)
+		}
+	}
+}
+
+func TestTransitiveClosureDependenciesFirst(t *testing.T) {
+	catalog := testCatalog(map[string][]string{
+		"A": {"B", "C"},
+		"B": {"D"},
+		"C": {"D", "E"},
+		"D": {"E"},
+		"E": nil,
+	})
+	closure, err := TransitiveClosure(catalog, []string{"A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	position := map[string]int{}
+	for i, m := range closure {
+		position[m.Name] = i
+	}
+	if len(position) != 5 || len(closure) != 5 {
+		t.Fatalf("closure = %q, want each of A-E exactly once", names(closure))
+	}
+	for _, m := range closure {
+		for _, d := range m.Dependencies {
+			if position[d.Name] > position[m.Name] {
+				t.Errorf("%s comes after %s, which depends on it: %q", d.Name, m.Name, names(closure))
+			}
+		}
+	}
+}
+
+func TestTransitiveClosureMissing(t *testing.T) {
+	catalog := testCatalog(map[string][]string{
+		"A": {"Ghost", "B"},
+		"B": {"Ghost"},
+	})
+	closure, err := TransitiveClosure(catalog, []string{"A", "Nope"})
+	var missing missingModsError
+	if !errors.As(err, &missing) {
+		t.Fatalf("error = %v, want missing mods", err)
+	}
+	want := missingModsError{
+		{name: "Ghost", requiredBy: []string{"A", "B"}},
+		{name: "Nope"},
+	}
+	if !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing = %+v, want %+v", missing, want)
+	}
+	const wantText = "required mods do not exist: Ghost (required by A, B), Nope"
+	if err.Error() != wantText {
+		t.Errorf("error text = %q, want %q", err.Error(), wantText)
+	}
+	// The rest of the closure is still computed.
+	if got := names(closure); !reflect.DeepEqual(got, []string{"B", "A"}) {
+		t.Errorf("closure = %q, want [B A]", got)
+	}
+}
+
+func TestTransitiveClosureCycles(t *testing.T) {
+	cases := []struct {
+		deps    map[string][]string
+		request []string
+		want    []cycleError
+	}{
+		{
+			deps:    map[string][]string{"A": {"A"}},
+			request: []string{"A"},
+			want:    []cycleError{{"A", "A"}},
+		},
+		{
+			deps:    map[string][]string{"A": {"B"}, "B": {"C"}, "C": {"A"}},
+			request: []string{"A"},
+			want:    []cycleError{{"A", "B", "C", "A"}},
+		},
+		{
+			// The cycle is reported starting from where it was entered, not from the request.
+			deps:    map[string][]string{"Top": {"A"}, "A": {"B"}, "B": {"A"}},
+			request: []string{"Top"},
+			want:    []cycleError{{"A", "B", "A"}},
+		},
+		{
+			deps:    map[string][]string{"A": {"B", "C"}, "B": {"A"}, "C": {"C"}},
+			request: []string{"A"},
+			want:    []cycleError{{"A", "B", "A"}, {"C", "C"}},
+		},
+	}
+	for _, c := range cases {
+		_, err := TransitiveClosure(testCatalog(c.deps), c.request)
+		var got []cycleError
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				var cycle cycleError
+				if errors.As(e, &cycle) {
+					got = append(got, cycle)
+				}
+			}
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("TransitiveClosure(%v, %q) cycles = %q, want %q", c.deps, c.request, got, c.want)
+		}
+	}
+}
+
+func TestCycleErrorText(t *testing.T) {
+	err := cycleError{"A", "B", "A"}
+	if got, want := err.Error(), "dependency cycle: A -> B -> A"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,179 @@
+package modlinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A Version is a mod version number: a sequence of dot-separated integers, compared component
+// by component. Missing components count as zero, so 1.2 and 1.2.0.0 are the same version.
+type Version []int
+
+// ParseVersion parses a version number such as "1.2.0.0".
+func ParseVersion(s string) (Version, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	v := make(Version, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version: %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+// Compare returns -1, 0 or 1 depending on whether v is lower than, equal to or higher than w.
+func (v Version) Compare(w Version) int {
+	for i := 0; i < len(v) || i < len(w); i++ {
+		var a, b int
+		if i < len(v) {
+			a = v[i]
+		}
+		if i < len(w) {
+			b = w[i]
+		}
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	}
+	return 0
+}
+
+// Pad returns v with zeros appended so that it has at least n components.
+func (v Version) Pad(n int) Version {
+	padded := append(Version{}, v...)
+	for len(padded) < n {
+		padded = append(padded, 0)
+	}
+	return padded
+}
+
+func (v Version) String() string {
+	parts := make([]string, len(v))
+	for i, n := range v {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// A Dependency names a mod that another mod requires, optionally restricting which versions of
+// it are acceptable.
+type Dependency struct {
+	Name string `xml:",chardata"`
+	// Version is a comma-separated list of comparisons, such as ">=2.1,<3", all of which
+	// the dependency's version must satisfy. A version with no operator must match exactly.
+	// It is empty if any version will do.
+	Version string `xml:",attr,omitempty"`
+}
+
+// ParseDependency parses a dependency written as a mod name, optionally followed by a version
+// constraint, as in "ItemChanger>=2.1".
+func ParseDependency(s string) (Dependency, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, "<>=")
+	if i == -1 {
+		return Dependency{Name: s}, nil
+	}
+	d := Dependency{Name: strings.TrimSpace(s[:i]), Version: strings.TrimSpace(s[i:])}
+	if _, err := d.SatisfiedBy("0"); err != nil {
+		return Dependency{}, err
+	}
+	return d, nil
+}
+
+func (d Dependency) String() string {
+	if d.Version == "" {
+		return d.Name
+	}
+	return d.Name + " (" + d.Version + ")"
+}
+
+var comparisons = []struct {
+	op string
+	ok func(cmp int) bool
+}{
+	// Two-character operators must come first, so that they aren't mistaken for their prefixes.
+	{">=", func(cmp int) bool { return cmp >= 0 }},
+	{"<=", func(cmp int) bool { return cmp <= 0 }},
+	{"==", func(cmp int) bool { return cmp == 0 }},
+	{">", func(cmp int) bool { return cmp > 0 }},
+	{"<", func(cmp int) bool { return cmp < 0 }},
+	{"=", func(cmp int) bool { return cmp == 0 }},
+}
+
+// SatisfiedBy reports whether the given version of the dependency meets its version constraint.
+func (d Dependency) SatisfiedBy(version string) (bool, error) {
+	if d.Version == "" {
+		return true, nil
+	}
+	v, err := ParseVersion(version)
+	if err != nil {
+		return false, err
+	}
+	satisfied := true
+	for _, term := range strings.Split(d.Version, ",") {
+		term = strings.TrimSpace(term)
+		op, ok := "", func(cmp int) bool { return cmp == 0 }
+		for _, c := range comparisons {
+			if strings.HasPrefix(term, c.op) {
+				op, ok = c.op, c.ok
+				break
+			}
+		}
+		bound, err := ParseVersion(strings.TrimPrefix(term, op))
+		if err != nil {
+			return false, fmt.Errorf("invalid version constraint for %s: %q", d.Name, d.Version)
+		}
+		if !ok(v.Compare(bound)) {
+			satisfied = false
+		}
+	}
+	return satisfied, nil
+}
+
+// DependencyNames returns the names of the given dependencies.
+func DependencyNames(deps []Dependency) []string {
+	if deps == nil {
+		return nil
+	}
+	names := make([]string, len(deps))
+	for i, d := range deps {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// MarshalJSON encodes a dependency with no version constraint as just its name, which is how
+// dependencies were stored before constraints existed.
+func (d Dependency) MarshalJSON() ([]byte, error) {
+	if d.Version == "" {
+		return json.Marshal(d.Name)
+	}
+	return json.Marshal(struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}{d.Name, d.Version})
+}
+
+func (d *Dependency) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*d = Dependency{Name: name}
+		return nil
+	}
+	var obj struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*d = Dependency{Name: obj.Name, Version: obj.Version}
+	return nil
+}
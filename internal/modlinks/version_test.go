@@ -0,0 +1,214 @@
+package modlinks
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		text    string
+		want    Version
+		wantErr bool
+	}{
+		{text: "1.2.0.0", want: Version{1, 2, 0, 0}},
+		{text: "3", want: Version{3}},
+		{text: " 1.10 ", want: Version{1, 10}},
+		{text: "", wantErr: true},
+		{text: "1..2", wantErr: true},
+		{text: "1.2a", wantErr: true},
+		{text: "1.-2", wantErr: true},
+		{text: "v1.2", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := ParseVersion(c.text)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("ParseVersion(%q) = %v, want error", c.text, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v", c.text, got, err, c.want)
+		}
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	cases := []struct {
+		a, b Version
+		want int
+	}{
+		{Version{1, 2}, Version{1, 2}, 0},
+		{Version{1, 2}, Version{1, 2, 0, 0}, 0},
+		{Version{1, 2, 0, 1}, Version{1, 2}, 1},
+		{Version{1, 2}, Version{1, 10}, -1},
+		{Version{2}, Version{1, 99, 99}, 1},
+		{Version{}, Version{0, 0}, 0},
+	}
+	for _, c := range cases {
+		if got := c.a.Compare(c.b); got != c.want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", c.a, c.b, got, c.want)
+		}
+		if got := c.b.Compare(c.a); got != -c.want {
+			t.Errorf("%v.Compare(%v) = %d, want %d", c.b, c.a, got, -c.want)
+		}
+	}
+}
+
+func TestVersionPad(t *testing.T) {
+	v := Version{1, 2}
+	if got := v.Pad(4).String(); got != "1.2.0.0" {
+		t.Errorf("Pad(4) = %s, want 1.2.0.0", got)
+	}
+	if got := (Version{1, 2, 3, 4, 5}).Pad(4).String(); got != "1.2.3.4.5" {
+		t.Errorf("Pad(4) of a longer version = %s, want 1.2.3.4.5", got)
+	}
+	if len(v) != 2 {
+		t.Errorf("Pad modified its receiver: %v", v)
+	}
+}
+
+func TestSatisfiedBy(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"", "anything", true},
+		{">=2.1,<3", "2.0.9", false},
+		{">=2.1,<3", "2.1", true},
+		{">=2.1,<3", "2.1.0.0", true},
+		{">=2.1,<3", "2.99", true},
+		{">=2.1,<3", "3.0.0.0", false},
+		{">= 2.1, < 3", "2.5", true},
+		{">2", "2.0.0.1", true},
+		{">2", "2", false},
+		{"<=1.5", "1.5.0.0", true},
+		{"<=1.5", "1.5.0.1", false},
+		{"<1.5", "1.4.9", true},
+		{"=1.2", "1.2.0.0", true},
+		{"==1.2", "1.2.0.1", false},
+		{"1.2", "1.2.0.0", true},
+		{"1.2", "1.3", false},
+	}
+	for _, c := range cases {
+		d := Dependency{Name: "Dep", Version: c.constraint}
+		got, err := d.SatisfiedBy(c.version)
+		if err != nil {
+			t.Errorf("%q SatisfiedBy(%q): %v", c.constraint, c.version, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q SatisfiedBy(%q) = %v, want %v", c.constraint, c.version, got, c.want)
+		}
+	}
+}
+
+func TestSatisfiedByErrors(t *testing.T) {
+	cases := []struct {
+		constraint string
+		version    string
+	}{
+		{">=2.x", "2.1"},
+		{">=", "2.1"},
+		{"=>2", "2.1"},
+		{">=2.1,", "2.1"},
+		{">=2.1", "latest"},
+	}
+	for _, c := range cases {
+		d := Dependency{Name: "Dep", Version: c.constraint}
+		if got, err := d.SatisfiedBy(c.version); err == nil {
+			t.Errorf("%q SatisfiedBy(%q) = %v, want error", c.constraint, c.version, got)
+		}
+	}
+}
+
+func TestParseDependency(t *testing.T) {
+	cases := []struct {
+		text    string
+		want    Dependency
+		wantErr bool
+	}{
+		{text: "ItemChanger", want: Dependency{Name: "ItemChanger"}},
+		{text: "  Randomizer 4 ", want: Dependency{Name: "Randomizer 4"}},
+		{text: "ItemChanger>=2.1", want: Dependency{Name: "ItemChanger", Version: ">=2.1"}},
+		{text: "ItemChanger >= 2.1,<3", want: Dependency{Name: "ItemChanger", Version: ">= 2.1,<3"}},
+		{text: "MenuChanger=1.0", want: Dependency{Name: "MenuChanger", Version: "=1.0"}},
+		{text: "MenuChanger<", wantErr: true},
+		{text: "MenuChanger>=one", wantErr: true},
+	}
+	for _, c := range cases {
+		got, err := ParseDependency(c.text)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("ParseDependency(%q) = %+v, want error", c.text, got)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("ParseDependency(%q) = %+v, %v, want %+v", c.text, got, err, c.want)
+		}
+	}
+}
+
+func TestDependencyString(t *testing.T) {
+	if got := (Dependency{Name: "A"}).String(); got != "A" {
+		t.Errorf("String() = %q, want %q", got, "A")
+	}
+	if got := (Dependency{Name: "A", Version: ">=1"}).String(); got != "A (>=1)" {
+		t.Errorf("String() = %q, want %q", got, "A (>=1)")
+	}
+}
+
+func TestDependencyJSON(t *testing.T) {
+	cases := []struct {
+		dep  Dependency
+		json string
+	}{
+		{Dependency{Name: "ItemChanger"}, `"ItemChanger"`},
+		// encoding/json escapes < and > by default.
+		{Dependency{Name: "ItemChanger", Version: ">=2.1"}, `{"name":"ItemChanger","version":"\u003e=2.1"}`},
+	}
+	for _, c := range cases {
+		data, err := json.Marshal(c.dep)
+		if err != nil {
+			t.Errorf("marshal %+v: %v", c.dep, err)
+			continue
+		}
+		if string(data) != c.json {
+			t.Errorf("marshal %+v = %s, want %s", c.dep, data, c.json)
+		}
+		var got Dependency
+		if err := json.Unmarshal(data, &got); err != nil || got != c.dep {
+			t.Errorf("unmarshal %s = %+v, %v, want %+v", data, got, err, c.dep)
+		}
+	}
+}
+
+func TestDependencyUnmarshalOldFormat(t *testing.T) {
+	// Install databases written before version constraints existed list dependencies as names.
+	var deps []Dependency
+	if err := json.Unmarshal([]byte(`["ItemChanger", {"name": "MenuChanger", "version": ">=1"}]`), &deps); err != nil {
+		t.Fatal(err)
+	}
+	want := []Dependency{{Name: "ItemChanger"}, {Name: "MenuChanger", Version: ">=1"}}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("got %+v, want %+v", deps, want)
+	}
+	var d Dependency
+	if err := json.Unmarshal([]byte(`42`), &d); err == nil {
+		t.Errorf("unmarshal 42 = %+v, want error", d)
+	}
+}
+
+func TestDependencyNames(t *testing.T) {
+	if got := DependencyNames(nil); got != nil {
+		t.Errorf("DependencyNames(nil) = %v, want nil", got)
+	}
+	got := DependencyNames([]Dependency{{Name: "A", Version: ">1"}, {Name: "B"}})
+	if want := []string{"A", "B"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DependencyNames = %v, want %v", got, want)
+	}
+}